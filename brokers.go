@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// brokerDialTimeout bounds the TCP connect, TLS handshake and protocol
+// handshake with a broker.
+const brokerDialTimeout = 10 * time.Second
+
+// brokerKeepAlive is how often an idle broker connection is pinged; a
+// connection silent for twice as long is dropped and redialed.
+const brokerKeepAlive = 30 * time.Second
+
+// dialBroker connects to a broker, over TLS when useTLS is set. TLS uses the
+// same CA and verification settings as the backend connection.
+func dialBroker(ctx context.Context, addr string, useTLS bool, base *http.Transport) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: brokerDialTimeout, KeepAlive: brokerKeepAlive}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !useTLS {
+		return conn, nil
+	}
+	return upgradeBrokerTLS(ctx, conn, addr, base)
+}
+
+func upgradeBrokerTLS(ctx context.Context, conn net.Conn, addr string, base *http.Transport) (net.Conn, error) {
+	var cfg *tls.Config
+	if base != nil && base.TLSClientConfig != nil {
+		cfg = base.TLSClientConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	cfg.NextProtos = nil
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsConn := tls.Client(conn, cfg)
+	hsCtx, cancel := context.WithTimeout(ctx, brokerDialTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// brokerClientID names the connection to the broker; MQTT needs it unique.
+func brokerClientID() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return "turbostream-tui-" + hex.EncodeToString(b[:])
+}
+
+// validateMQTTFilter checks an MQTT topic filter: + stands for one whole
+// level and # for the remaining levels, so it must come last.
+func validateMQTTFilter(filter string) error {
+	if filter == "" {
+		return errors.New("empty topic")
+	}
+	if strings.ContainsRune(filter, 0) {
+		return fmt.Errorf("topic %q contains a NUL character", filter)
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("topic %q: + must be a whole level", filter)
+		}
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("topic %q: # must be the whole last level", filter)
+		}
+	}
+	return nil
+}
+
+// validateNATSSubject checks a NATS subject: * stands for one whole token and
+// > for the remaining tokens, so it must come last.
+func validateNATSSubject(subject string) error {
+	if subject == "" {
+		return errors.New("empty subject")
+	}
+	if strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("subject %q contains whitespace", subject)
+	}
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return fmt.Errorf("subject %q has an empty token", subject)
+		case strings.Contains(token, "*") && token != "*":
+			return fmt.Errorf("subject %q: * must be a whole token", subject)
+		case strings.Contains(token, ">") && (token != ">" || i != len(tokens)-1):
+			return fmt.Errorf("subject %q: > must be the whole last token", subject)
+		}
+	}
+	return nil
+}
+
+// MQTT 3.1.1 control packet types, shifted into the high nibble.
+const (
+	mqttConnect    = 1 << 4
+	mqttConnack    = 2 << 4
+	mqttPublish    = 3 << 4
+	mqttPuback     = 4 << 4
+	mqttPubrec     = 5 << 4
+	mqttPubrel     = 6 << 4
+	mqttPubcomp    = 7 << 4
+	mqttSubscribe  = 8 << 4
+	mqttSuback     = 9 << 4
+	mqttPingreq    = 12 << 4
+	mqttDisconnect = 14 << 4
+)
+
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttTransport subscribes to MQTT 3.1.1 topic filters with QoS 1 and
+// delivers every publish with its concrete topic.
+type mqttTransport struct {
+	addr     string
+	useTLS   bool
+	base     *http.Transport
+	username string
+	password string
+	topics   []string
+
+	mu   sync.Mutex // serializes writes from the reader and the keepalive
+	conn net.Conn
+}
+
+func (t *mqttTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	conn, err := dialBroker(ctx, t.addr, t.useTLS, t.base)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		t.write(mqttDisconnect, nil)
+		conn.Close()
+	})
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(brokerDialTimeout))
+	if err := t.handshake(reader); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	connected()
+
+	go t.keepAlive(ctx)
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * brokerKeepAlive))
+		typ, body, wire, err := t.readPacket(reader)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		switch typ & 0xF0 {
+		case mqttPublish:
+			if msg, ok := t.publish(typ, body, wire); ok {
+				deliver(msg)
+			}
+		case mqttPubrel:
+			if len(body) >= 2 {
+				t.write(mqttPubcomp, body[:2])
+			}
+		}
+	}
+}
+
+// handshake sends CONNECT and SUBSCRIBE and waits for the broker to accept both.
+func (t *mqttTransport) handshake(reader *bufio.Reader) error {
+	flags := byte(0x02) // clean session
+	var payload bytes.Buffer
+	writeMQTTString(&payload, brokerClientID())
+	if t.username != "" {
+		flags |= 0x80
+		writeMQTTString(&payload, t.username)
+	}
+	if t.password != "" {
+		flags |= 0x40
+		writeMQTTString(&payload, t.password)
+	}
+	var connect bytes.Buffer
+	writeMQTTString(&connect, "MQTT")
+	connect.WriteByte(4) // protocol level 3.1.1
+	connect.WriteByte(flags)
+	binary.Write(&connect, binary.BigEndian, uint16(brokerKeepAlive/time.Second))
+	connect.Write(payload.Bytes())
+	if err := t.write(mqttConnect, connect.Bytes()); err != nil {
+		return err
+	}
+	typ, body, _, err := t.readPacket(reader)
+	if err != nil {
+		return err
+	}
+	if typ&0xF0 != mqttConnack || len(body) < 2 {
+		return fmt.Errorf("expected CONNACK, got packet type %d", typ>>4)
+	}
+	if code := body[1]; code != 0 {
+		reason, ok := mqttConnackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		err := fmt.Errorf("broker refused connection: %s", reason)
+		if code == 4 || code == 5 {
+			// Retrying with the same credentials can't succeed
+			return sourceEnded(err)
+		}
+		return err
+	}
+
+	var subscribe bytes.Buffer
+	binary.Write(&subscribe, binary.BigEndian, uint16(1)) // packet identifier
+	for _, topic := range t.topics {
+		writeMQTTString(&subscribe, topic)
+		subscribe.WriteByte(1) // QoS 1
+	}
+	if err := t.write(mqttSubscribe|0x02, subscribe.Bytes()); err != nil {
+		return err
+	}
+	for {
+		typ, body, _, err := t.readPacket(reader)
+		if err != nil {
+			return err
+		}
+		if typ&0xF0 != mqttSuback {
+			// A compliant broker acknowledges before publishing; skip anything else
+			continue
+		}
+		if len(body) < 2+len(t.topics) {
+			return errors.New("malformed SUBACK")
+		}
+		for i, code := range body[2 : 2+len(t.topics)] {
+			if code == 0x80 {
+				return sourceEnded(fmt.Errorf("broker refused subscription to %q", t.topics[i]))
+			}
+		}
+		return nil
+	}
+}
+
+// publish decodes a PUBLISH and acknowledges it as its QoS requires.
+func (t *mqttTransport) publish(typ byte, body []byte, wire int) (sourceMessage, bool) {
+	qos := (typ >> 1) & 0x03
+	if len(body) < 2 {
+		return sourceMessage{Dropped: "malformed_packet"}, true
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return sourceMessage{Dropped: "malformed_packet"}, true
+	}
+	topic := string(body[2 : 2+n])
+	rest := body[2+n:]
+	if qos > 0 {
+		if len(rest) < 2 {
+			return sourceMessage{Dropped: "malformed_packet"}, true
+		}
+		id := rest[:2]
+		rest = rest[2:]
+		switch qos {
+		case 1:
+			t.write(mqttPuback, id)
+		case 2:
+			t.write(mqttPubrec, id)
+		}
+	}
+	payload := bytes.TrimSpace(rest)
+	if len(payload) == 0 {
+		return sourceMessage{}, false
+	}
+	return sourceMessage{
+		Data:  append([]byte(nil), payload...),
+		Topic: topic,
+		Frame: frameSize{Wire: wire, Decoded: len(payload)},
+	}, true
+}
+
+func (t *mqttTransport) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(brokerKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.write(mqttPingreq, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends one control packet.
+func (t *mqttTransport) write(typ byte, body []byte) error {
+	var packet bytes.Buffer
+	packet.WriteByte(typ)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet.WriteByte(b)
+		if n == 0 {
+			break
+		}
+	}
+	packet.Write(body)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn.SetWriteDeadline(time.Now().Add(brokerDialTimeout))
+	_, err := t.conn.Write(packet.Bytes())
+	return err
+}
+
+// readPacket reads one control packet and returns its first byte, its body
+// and its size on the wire.
+func (t *mqttTransport) readPacket(r *bufio.Reader) (byte, []byte, int, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	length, multiplier, header := 0, 1, 1
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		header++
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+		if header > 4 {
+			return 0, nil, 0, errors.New("malformed remaining length")
+		}
+	}
+	if length > localReadLimit {
+		return 0, nil, 0, fmt.Errorf("packet of %d bytes exceeds the %d byte limit", length, localReadLimit)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, 0, err
+	}
+	return typ, body, header + length, nil
+}
+
+func writeMQTTString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+// natsInfo is the part of the server's INFO the client needs.
+type natsInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	AuthRequired bool `json:"auth_required"`
+}
+
+// natsTransport subscribes to NATS subjects over the client protocol and
+// delivers every message with its concrete subject.
+type natsTransport struct {
+	addr     string
+	useTLS   bool
+	base     *http.Transport
+	username string
+	password string // either one alone is sent as the auth token
+	topics   []string
+
+	mu   sync.Mutex // serializes writes from the reader and the keepalive
+	conn net.Conn
+}
+
+func (t *natsTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	conn, err := dialBroker(ctx, t.addr, false, t.base)
+	if err != nil {
+		return err
+	}
+	defer func() { t.conn.Close() }()
+	t.conn = conn
+	conn.SetDeadline(time.Now().Add(brokerDialTimeout))
+
+	// The server speaks first; TLS, when used, starts after its INFO
+	reader := bufio.NewReader(conn)
+	line, err := readNATSLine(reader)
+	if err != nil {
+		return err
+	}
+	verb, args, _ := strings.Cut(line, " ")
+	if verb != "INFO" {
+		return fmt.Errorf("expected INFO, got %q", truncate(line, 40))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		// Guessing tls_required or auth_required would fail later and less clearly
+		return fmt.Errorf("malformed INFO %q: %w", truncate(args, 40), err)
+	}
+	if t.useTLS || info.TLSRequired {
+		tlsConn, err := upgradeBrokerTLS(ctx, conn, t.addr, t.base)
+		if err != nil {
+			return err
+		}
+		t.conn = tlsConn
+		tlsConn.SetDeadline(time.Now().Add(brokerDialTimeout))
+		reader = bufio.NewReader(tlsConn)
+	}
+	stop := context.AfterFunc(ctx, func() { t.conn.Close() })
+	defer stop()
+
+	if err := t.handshake(reader); err != nil {
+		return err
+	}
+	t.conn.SetDeadline(time.Time{})
+	connected()
+
+	go t.keepAlive(ctx)
+	for {
+		t.conn.SetReadDeadline(time.Now().Add(2 * brokerKeepAlive))
+		line, err := readNATSLine(reader)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		verb, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "MSG":
+			msg, err := t.readMsg(reader, line, args)
+			if err != nil {
+				return err
+			}
+			if len(msg.Data) > 0 {
+				deliver(msg)
+			}
+		case "PING":
+			if err := t.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("server error: %s", args)
+		}
+	}
+}
+
+// handshake sends CONNECT and the subscriptions, then a PING whose PONG
+// confirms the server accepted them.
+func (t *natsTransport) handshake(reader *bufio.Reader) error {
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "turbostream-tui",
+		"lang":     "go",
+		"version":  "1",
+		"protocol": 1,
+	}
+	switch {
+	case t.username != "" && t.password != "":
+		connect["user"] = t.username
+		connect["pass"] = t.password
+	case t.password != "":
+		connect["auth_token"] = t.password
+	case t.username != "":
+		// nats://token@host
+		connect["auth_token"] = t.username
+	}
+	raw, _ := json.Marshal(connect)
+	var cmds strings.Builder
+	fmt.Fprintf(&cmds, "CONNECT %s\r\n", raw)
+	for i, topic := range t.topics {
+		fmt.Fprintf(&cmds, "SUB %s %d\r\n", topic, i+1)
+	}
+	cmds.WriteString("PING\r\n")
+	if err := t.write(cmds.String()); err != nil {
+		return err
+	}
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			return err
+		}
+		verb, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "PONG":
+			return nil
+		case "-ERR":
+			err := fmt.Errorf("server refused connection: %s", args)
+			if strings.Contains(strings.ToLower(args), "authorization") {
+				// Retrying with the same credentials can't succeed
+				return sourceEnded(err)
+			}
+			return err
+		}
+	}
+}
+
+// readMsg reads the payload announced by a MSG line: MSG <subject> <sid> [reply-to] <#bytes>.
+func (t *natsTransport) readMsg(reader *bufio.Reader, line, args string) (sourceMessage, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 {
+		return sourceMessage{}, fmt.Errorf("malformed MSG %q", truncate(line, 40))
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 || size > localReadLimit {
+		return sourceMessage{}, fmt.Errorf("malformed MSG %q", truncate(line, 40))
+	}
+	payload := make([]byte, size+2) // with the trailing CRLF
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return sourceMessage{}, err
+	}
+	data := bytes.TrimSpace(payload[:size])
+	return sourceMessage{
+		Data:  data,
+		Topic: fields[0],
+		Frame: frameSize{Wire: len(line) + 2 + size + 2, Decoded: len(data)},
+	}, nil
+}
+
+func (t *natsTransport) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(brokerKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.write("PING\r\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (t *natsTransport) write(s string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn.SetWriteDeadline(time.Now().Add(brokerDialTimeout))
+	_, err := io.WriteString(t.conn, s)
+	return err
+}
+
+// readNATSLine reads one CRLF-terminated protocol line.
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) > localReadLimit {
+		return "", errors.New("protocol line too long")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fakeBroker accepts one client on a loopback port and runs serve on it.
+func fakeBroker(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+// runTransport runs tr until it fails or want messages arrived; with want 0
+// it waits for the failure.
+func runTransport(t *testing.T, tr sourceTransport, want int) ([]sourceMessage, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgs := make(chan sourceMessage, 16)
+	done := make(chan error, 1)
+	go func() { done <- tr.Run(ctx, func() {}, func(m sourceMessage) { msgs <- m }) }()
+
+	var got []sourceMessage
+	for want == 0 || len(got) < want {
+		select {
+		case m := <-msgs:
+			got = append(got, m)
+		case err := <-done:
+			return got, err
+		case <-ctx.Done():
+			return got, fmt.Errorf("timed out with %d of %d messages", len(got), want)
+		}
+	}
+	cancel()
+	<-done
+	return got, nil
+}
+
+// brokerClient is the part of a broker transport's settings a test varies.
+type brokerClient struct {
+	username, password string
+	topics             []string
+}
+
+func topicsOf(msgs []sourceMessage) []string {
+	var topics []string
+	for _, m := range msgs {
+		topics = append(topics, m.Topic+"="+string(m.Data))
+	}
+	return topics
+}
+
+// matchLevels matches a topic against a filter split on sep, with one and
+// rest as the single-level and multi-level wildcards.
+func matchLevels(filter, topic, sep, one, rest string) bool {
+	f, tl := strings.Split(filter, sep), strings.Split(topic, sep)
+	for i, level := range f {
+		if level == rest {
+			return true
+		}
+		if i >= len(tl) || (level != one && level != tl[i]) {
+			return false
+		}
+	}
+	return len(f) == len(tl)
+}
+
+// mqttBroker is a minimal MQTT 3.1.1 broker: it checks the credentials,
+// acknowledges the subscription and publishes the matching topics at QoS 1.
+type mqttBroker struct {
+	username, password string
+	connackCode        byte // forced CONNACK return code, 0 to check credentials
+	refuseTopic        string
+	publish            []string // "topic=payload"
+
+	filters chan []string
+}
+
+func (b *mqttBroker) serve(conn net.Conn) {
+	peer := &mqttTransport{conn: conn} // reuses the client's packet framing
+	reader := bufio.NewReader(conn)
+
+	_, body, _, err := peer.readPacket(reader)
+	if err != nil {
+		return
+	}
+	code := b.connackCode
+	if user, pass := mqttConnectCredentials(body); code == 0 && (user != b.username || pass != b.password) {
+		code = 4
+	}
+	peer.write(mqttConnack, []byte{0, code})
+	if code != 0 {
+		return
+	}
+
+	typ, body, _, err := peer.readPacket(reader)
+	if err != nil || typ&0xF0 != mqttSubscribe {
+		return
+	}
+	var filters []string
+	suback := append([]byte(nil), body[:2]...)
+	for rest := body[2:]; len(rest) > 2; {
+		n := int(binary.BigEndian.Uint16(rest))
+		filter := string(rest[2 : 2+n])
+		filters = append(filters, filter)
+		rest = rest[2+n+1:] // the requested QoS follows
+		if filter == b.refuseTopic {
+			suback = append(suback, 0x80)
+		} else {
+			suback = append(suback, 1)
+		}
+	}
+	b.filters <- filters
+	peer.write(mqttSuback, suback)
+
+	for i, p := range b.publish {
+		topic, payload, _ := strings.Cut(p, "=")
+		for _, filter := range filters {
+			if matchLevels(filter, topic, "/", "+", "#") {
+				var pkt bytes.Buffer
+				writeMQTTString(&pkt, topic)
+				binary.Write(&pkt, binary.BigEndian, uint16(i+1))
+				pkt.WriteString(payload)
+				peer.write(mqttPublish|0x02, pkt.Bytes())
+				break
+			}
+		}
+	}
+	// Drain PUBACKs and PINGREQs until the client leaves
+	for {
+		if _, _, _, err := peer.readPacket(reader); err != nil {
+			return
+		}
+	}
+}
+
+// mqttConnectCredentials reads the user name and password of a CONNECT body.
+func mqttConnectCredentials(body []byte) (user, pass string) {
+	flags := body[7]
+	rest := body[10:]
+	next := func() string {
+		n := int(binary.BigEndian.Uint16(rest))
+		s := string(rest[2 : 2+n])
+		rest = rest[2+n:]
+		return s
+	}
+	next() // client ID
+	if flags&0x80 != 0 {
+		user = next()
+	}
+	if flags&0x40 != 0 {
+		pass = next()
+	}
+	return user, pass
+}
+
+func TestMQTTTransport(t *testing.T) {
+	readings := []string{
+		"sensors/kitchen/temp=21.5",
+		"sensors/kitchen/humidity=40",
+		"sensors/garage/temp=12",
+		"alerts/smoke=1",
+	}
+	tests := []struct {
+		name    string
+		broker  mqttBroker
+		client  brokerClient
+		want    []string
+		wantErr string
+		ended   bool
+	}{
+		{
+			name:   "single-level wildcard",
+			broker: mqttBroker{publish: readings},
+			client: brokerClient{topics: []string{"sensors/+/temp"}},
+			want:   []string{"sensors/kitchen/temp=21.5", "sensors/garage/temp=12"},
+		},
+		{
+			name:   "several filters",
+			broker: mqttBroker{username: "iot", password: "s3cret", publish: readings},
+			client: brokerClient{username: "iot", password: "s3cret", topics: []string{"sensors/kitchen/#", "alerts/+"}},
+			want:   []string{"sensors/kitchen/temp=21.5", "sensors/kitchen/humidity=40", "alerts/smoke=1"},
+		},
+		{
+			name:    "bad credentials",
+			broker:  mqttBroker{username: "iot", password: "s3cret"},
+			client:  brokerClient{username: "iot", password: "wrong", topics: []string{"#"}},
+			wantErr: "bad user name or password",
+			ended:   true,
+		},
+		{
+			name:    "not authorized",
+			broker:  mqttBroker{connackCode: 5},
+			client:  brokerClient{topics: []string{"#"}},
+			wantErr: "not authorized",
+			ended:   true,
+		},
+		{
+			name:    "server unavailable is retried",
+			broker:  mqttBroker{connackCode: 3},
+			client:  brokerClient{topics: []string{"#"}},
+			wantErr: "server unavailable",
+		},
+		{
+			name:    "subscription refused",
+			broker:  mqttBroker{refuseTopic: "secret/#"},
+			client:  brokerClient{topics: []string{"sensors/#", "secret/#"}},
+			wantErr: `refused subscription to "secret/#"`,
+			ended:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := tt.broker
+			broker.filters = make(chan []string, 1)
+			client := &mqttTransport{addr: fakeBroker(t, broker.serve),
+				username: tt.client.username, password: tt.client.password, topics: tt.client.topics}
+
+			got, err := runTransport(t, client, len(tt.want))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want %q", err, tt.wantErr)
+				}
+				if ended := errors.Is(err, errSourceEnded); ended != tt.ended {
+					t.Errorf("source ended = %v, want %v", ended, tt.ended)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filters := <-broker.filters; strings.Join(filters, ",") != strings.Join(tt.client.topics, ",") {
+				t.Errorf("subscribed to %v, want %v", filters, tt.client.topics)
+			}
+			if topics := topicsOf(got); strings.Join(topics, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("delivered %v, want %v", topics, tt.want)
+			}
+		})
+	}
+}
+
+// natsServer is a minimal NATS server: it sends INFO, checks the CONNECT
+// credentials and publishes the subjects matching the subscriptions.
+type natsServer struct {
+	info     string // INFO arguments; a default when empty
+	user     string
+	pass     string
+	token    string
+	publish  []string // "subject=payload"
+	subjects chan []string
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	info := s.info
+	if info == "" {
+		info = fmt.Sprintf(`{"server_id":"fake","auth_required":%v}`, s.user != "" || s.token != "")
+	}
+	fmt.Fprintf(conn, "INFO %s\r\n", info)
+	reader := bufio.NewReader(conn)
+
+	sids := map[string]string{} // subject -> sid
+	var subjects []string
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			return
+		}
+		verb, args, _ := strings.Cut(line, " ")
+		switch verb {
+		case "CONNECT":
+			var opts struct {
+				User  string `json:"user"`
+				Pass  string `json:"pass"`
+				Token string `json:"auth_token"`
+			}
+			json.Unmarshal([]byte(args), &opts)
+			if opts.User != s.user || opts.Pass != s.pass || opts.Token != s.token {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "SUB":
+			fields := strings.Fields(args)
+			sids[fields[0]] = fields[len(fields)-1]
+			subjects = append(subjects, fields[0])
+		case "PING":
+			s.subjects <- subjects
+			fmt.Fprint(conn, "PONG\r\n")
+			for _, p := range s.publish {
+				subject, payload, _ := strings.Cut(p, "=")
+				for _, sub := range subjects {
+					if matchLevels(sub, subject, ".", "*", ">") {
+						fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", subject, sids[sub], len(payload), payload)
+						break
+					}
+				}
+			}
+			// Answer keepalives until the client leaves
+			for {
+				line, err := readNATSLine(reader)
+				if err != nil {
+					return
+				}
+				if line == "PING" {
+					fmt.Fprint(conn, "PONG\r\n")
+				}
+			}
+		}
+	}
+}
+
+func TestNATSTransport(t *testing.T) {
+	readings := []string{
+		"sensors.kitchen.temp=21.5",
+		"sensors.kitchen.humidity=40",
+		"sensors.garage.temp=12",
+	}
+	tests := []struct {
+		name    string
+		server  natsServer
+		client  brokerClient
+		want    []string
+		wantErr string
+		ended   bool
+	}{
+		{
+			name:   "single-token wildcard",
+			server: natsServer{publish: readings},
+			client: brokerClient{topics: []string{"sensors.*.temp"}},
+			want:   []string{"sensors.kitchen.temp=21.5", "sensors.garage.temp=12"},
+		},
+		{
+			name:   "user and password",
+			server: natsServer{user: "iot", pass: "s3cret", publish: readings},
+			client: brokerClient{username: "iot", password: "s3cret", topics: []string{"sensors.kitchen.>"}},
+			want:   []string{"sensors.kitchen.temp=21.5", "sensors.kitchen.humidity=40"},
+		},
+		{
+			name:   "token from the user info",
+			server: natsServer{token: "t0ken", publish: readings},
+			client: brokerClient{username: "t0ken", topics: []string{"sensors.garage.temp"}},
+			want:   []string{"sensors.garage.temp=12"},
+		},
+		{
+			name:    "authorization violation",
+			server:  natsServer{user: "iot", pass: "s3cret"},
+			client:  brokerClient{username: "iot", password: "wrong", topics: []string{">"}},
+			wantErr: "Authorization Violation",
+			ended:   true,
+		},
+		{
+			name:    "malformed INFO",
+			server:  natsServer{info: `{"tls_required":tru`},
+			client:  brokerClient{topics: []string{">"}},
+			wantErr: "malformed INFO",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server
+			server.subjects = make(chan []string, 1)
+			client := &natsTransport{addr: fakeBroker(t, server.serve),
+				username: tt.client.username, password: tt.client.password, topics: tt.client.topics}
+
+			got, err := runTransport(t, client, len(tt.want))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want %q", err, tt.wantErr)
+				}
+				if ended := errors.Is(err, errSourceEnded); ended != tt.ended {
+					t.Errorf("source ended = %v, want %v", ended, tt.ended)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subjects := <-server.subjects; strings.Join(subjects, ",") != strings.Join(tt.client.topics, ",") {
+				t.Errorf("subscribed to %v, want %v", subjects, tt.client.topics)
+			}
+			if topics := topicsOf(got); strings.Join(topics, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("delivered %v, want %v", topics, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrokerSourceFeedPerTopic(t *testing.T) {
+	broker := &mqttBroker{
+		username: "iot",
+		password: "s3cret",
+		publish:  []string{"sensors/kitchen/temp=21.5", "sensors/garage/temp=12", "sensors/kitchen/temp=22"},
+		filters:  make(chan []string, 1),
+	}
+	addr := fakeBroker(t, broker.serve)
+	cfg, err := localSourceConfig{Name: "iot", URL: "mqtt://iot:s3cret@" + addr, Topics: []string{"sensors/+/temp"}}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cfg.URL, "s3cret") {
+		t.Errorf("credentials left in the feed URL %q", cfg.URL)
+	}
+
+	in := newIngestor(ingestConfig{BufferSize: 16, FrameInterval: 10 * time.Millisecond}, NewMetricsCollector())
+	defer in.Close()
+	src := newLocalSource("local:1", cfg, wsOptions{Ingest: in, Reconnect: reconnectPolicy{MaxAttempts: 1}})
+	defer src.Close()
+	go func() {
+		// The UI would handle the status and new-topic messages
+		for range src.incoming {
+		}
+	}()
+	src.Start()
+
+	events := map[string][]feedDataMsg{}
+	deadline := time.After(5 * time.Second)
+	for n := 0; n < 3; {
+		batch := make(chan tea.Msg, 1)
+		go func() { batch <- in.ListenCmd()() }()
+		select {
+		case msg := <-batch:
+			for feedID, evs := range msg.(feedBatchMsg).Feeds {
+				events[feedID] = append(events[feedID], evs...)
+				n += len(evs)
+			}
+		case <-deadline:
+			t.Fatalf("timed out with events %v", events)
+		}
+	}
+
+	want := map[string][]string{
+		"local:1/sensors/kitchen/temp": {"21.5", "22"},
+		"local:1/sensors/garage/temp":  {"12"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events went to feeds %v, want one per concrete topic", events)
+	}
+	for feedID, data := range want {
+		evs := events[feedID]
+		if len(evs) != len(data) {
+			t.Fatalf("feed %s got %d events, want %d", feedID, len(evs), len(data))
+		}
+		topic := strings.TrimPrefix(feedID, "local:1/")
+		for i, e := range evs {
+			if e.EventName != topic || e.Data != data[i] || e.Seq != int64(i+1) {
+				t.Errorf("feed %s event %d = {%s %s seq %d}, want {%s %s seq %d}",
+					feedID, i, e.EventName, e.Data, e.Seq, topic, data[i], i+1)
+			}
+		}
+	}
+	if feeds := src.Feeds(); len(feeds) != 3 || feeds[0].ID != "local:1" {
+		t.Errorf("Feeds() = %+v, want the source feed and one per topic", feeds)
+	}
+}
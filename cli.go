@@ -0,0 +1,1008 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// Exit codes of the headless subcommands.
+const (
+	exitOK          = 0
+	exitError       = 1   // anything not covered below
+	exitUsage       = 2   // bad arguments or config
+	exitAuth        = 3   // not logged in, session rejected or not allowed
+	exitNotFound    = 4   // feed or subscription does not exist
+	exitInvalid     = 5   // backend rejected the input
+	exitUnavailable = 6   // backend unreachable, overloaded or failing
+	exitInterrupted = 130 // Ctrl+C
+)
+
+const cliUserAgent = "TurboStream CLI"
+
+var (
+	errNotLoggedIn = errors.New("not logged in; run `turbostream-tui login` first")
+	errStreamLost  = errors.New("connection lost")
+)
+
+// usageError is a mistake in the command line itself.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  turbostream-tui [--profile NAME]                 start the TUI
+  turbostream-tui [--profile NAME] COMMAND [ARGS]  run a command and exit
+  turbostream-tui --record FILE                    start the TUI and record the session
+  turbostream-tui --replay FILE [--replay-speed S] replay a recorded session offline
+  turbostream-tui --metrics-addr ADDR              also serve Prometheus metrics, e.g. on :9464
+  turbostream-tui --otlp-endpoint URL              also send OpenTelemetry traces, e.g. to localhost:4318
+  turbostream-tui --local URL|PATH|ADDR|- [--local-type T] [--local-message M] [--local-event PATH]
+                  [--local-data PATH] [--local-interval D] [--local-topic T] [--local-user U] [--local-name N]
+                                                   watch a source directly, no account needed
+
+Commands:
+  login                       log in and save the session
+  feeds list [--mine]         list marketplace feeds (or only yours)
+  feeds get FEED              show one feed
+  feeds create --name N --url U [flags]
+  feeds update FEED [flags]   change only the given fields
+  feeds delete FEED
+  subs list                   list your subscriptions
+  subs add FEED               subscribe to a feed
+  subs rm FEED                unsubscribe from a feed
+  tail FEED [-n COUNT]        print feed-data events as NDJSON
+  ask FEED "QUESTION"         stream an AI answer about a feed
+
+FEED is a feed ID or name. Every command accepts --output json|table.
+Run "turbostream-tui COMMAND --help" for the command's flags.
+
+Exit codes: 0 ok, 1 error, 2 usage, 3 auth, 4 not found, 5 invalid input,
+6 backend unavailable, 130 interrupted.
+`)
+}
+
+// runCLI runs one headless subcommand and returns the process exit code.
+func runCLI(s *startup, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch args[0] {
+	case "login":
+		err = cmdLogin(ctx, s, args[1:])
+	case "feeds":
+		err = cmdFeeds(ctx, s, args[1:])
+	case "subs":
+		err = cmdSubs(ctx, s, args[1:])
+	case "tail":
+		err = cmdTail(ctx, s, args[1:])
+	case "ask":
+		err = cmdAsk(ctx, s, args[1:])
+	case "help":
+		printUsage()
+		return exitOK
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", args[0]))
+	}
+
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	code := exitCode(err)
+	if code != exitInterrupted {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+	if code == exitUsage {
+		fmt.Fprintln(os.Stderr, `run "turbostream-tui help" for usage`)
+	}
+	return code
+}
+
+// exitCode maps an error to the documented exit codes.
+func exitCode(err error) int {
+	var (
+		usage     usageError
+		authErr   *api.AuthRequiredError
+		twoFactor *api.TwoFactorRequiredError
+		forbidden *api.ForbiddenError
+		notFound  *api.NotFoundError
+		invalid   *api.ValidationError
+		limited   *api.RateLimitedError
+		server    *api.ServerError
+		urlErr    *url.Error
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, errNotLoggedIn), isAuthFailure(err),
+		errors.As(err, &authErr), errors.As(err, &twoFactor), errors.As(err, &forbidden):
+		return exitAuth
+	case errors.As(err, &notFound):
+		return exitNotFound
+	case errors.As(err, &invalid):
+		return exitInvalid
+	case errors.As(err, &limited), errors.As(err, &server), errors.As(err, &urlErr),
+		errors.Is(err, errStreamLost):
+		return exitUnavailable
+	}
+	return exitError
+}
+
+// ---- Flags and output ----
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// outputFlag registers --output (and -o) with the command's default format.
+func outputFlag(fs *flag.FlagSet, def string) *string {
+	format := fs.String("output", def, "output format: json or table")
+	fs.StringVar(format, "o", def, "shorthand for --output")
+	return format
+}
+
+// repeatedFlag collects every value of a flag given more than once.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, ", ") }
+
+func (f *repeatedFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// parseArgs parses flags anywhere on the command line, so
+// "feeds get ID --output json" works like "feeds get --output json ID".
+// Everything after "--" is positional, e.g. a question starting with "-".
+func parseArgs(fs *flag.FlagSet, args []string, format *string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageError(err.Error())
+		}
+		rest := fs.Args()
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		args = rest
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if format != nil && *format != "json" && *format != "table" {
+		return nil, usageError(fmt.Sprintf("unknown output format %q (want json or table)", *format))
+	}
+	return positional, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes tab-separated rows as aligned columns.
+func printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// ---- Session ----
+
+// requireSession checks that a session was restored and refreshes it when it
+// is about to expire, saving the new tokens for the next run.
+func (s *startup) requireSession(ctx context.Context) error {
+	if s.token == "" {
+		return errNotLoggedIn
+	}
+	exp, ok := api.TokenExpiry(s.token)
+	if !ok || time.Until(exp) > tokenRefreshLead {
+		return nil
+	}
+	if s.refreshToken == "" {
+		if time.Now().After(exp) {
+			return fmt.Errorf("session expired: %w", errNotLoggedIn)
+		}
+		return nil
+	}
+	sess, err := s.client.Refresh(ctx, s.refreshToken)
+	if err != nil {
+		var notFound *api.NotFoundError
+		if errors.As(err, &notFound) && time.Now().Before(exp) {
+			// No refresh endpoint; the token is still good for now
+			return nil
+		}
+		return fmt.Errorf("refresh session: %w", err)
+	}
+	s.token = sess.Token
+	s.refreshToken = sess.RefreshToken
+	s.client.SetToken(s.token)
+	if err := s.store.Save(storedSession{Token: s.token, RefreshToken: s.refreshToken}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not save session to %s: %v\n", s.store.Name(), err)
+	}
+	return nil
+}
+
+// resolveFeed looks a feed up by ID, falling back to a case-insensitive name match.
+func (s *startup) resolveFeed(ctx context.Context, ref string) (*api.Feed, error) {
+	feed, err := s.client.Feed(ctx, ref)
+	var notFound *api.NotFoundError
+	if err == nil && feed != nil {
+		return feed, nil
+	}
+	if err != nil && !errors.As(err, &notFound) {
+		// IDs and names share the path; a malformed ID may come back as 400
+		var invalid *api.ValidationError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+	}
+	feeds, err := s.client.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range feeds {
+		if strings.EqualFold(feeds[i].Name, ref) {
+			return &feeds[i], nil
+		}
+	}
+	return nil, fmt.Errorf("feed %q: %w", ref, &api.NotFoundError{ErrorBody: api.ErrorBody{StatusCode: 404, Message: "feed not found"}})
+}
+
+// ---- login ----
+
+func cmdLogin(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("login")
+	email := fs.String("email", s.profile.Email, "account email")
+	totp := fs.String("totp", "", "two-factor code, if enabled")
+	format := outputFlag(fs, "table")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: turbostream-tui login [--email EMAIL] [--totp CODE]")
+		fmt.Fprintln(os.Stderr, "The password is read from TURBOSTREAM_PASSWORD, the terminal or stdin.")
+		fs.PrintDefaults()
+	}
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return usageError("login takes no arguments")
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	if *email == "" {
+		if *email, err = prompt(stdin, "Email: ", false); err != nil {
+			return err
+		}
+	}
+	password := os.Getenv("TURBOSTREAM_PASSWORD")
+	if password == "" {
+		if password, err = prompt(stdin, "Password: ", true); err != nil {
+			return err
+		}
+	}
+
+	sess, err := s.client.Login(ctx, *email, password, *totp)
+	var twoFactor *api.TwoFactorRequiredError
+	if errors.As(err, &twoFactor) && *totp == "" && term.IsTerminal(os.Stdin.Fd()) {
+		code, perr := prompt(stdin, "2FA code: ", false)
+		if perr != nil {
+			return perr
+		}
+		sess, err = s.client.Login(ctx, *email, password, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Save(storedSession{Token: sess.Token, RefreshToken: sess.RefreshToken}); err != nil {
+		return fmt.Errorf("save session to %s: %w", s.store.Name(), err)
+	}
+
+	user := sess.User
+	if user == nil {
+		user = &api.User{Email: *email}
+	}
+	if *format == "json" {
+		return printJSON(map[string]string{
+			"userId":  user.ID,
+			"email":   user.Email,
+			"name":    user.Name,
+			"backend": s.profile.BackendURL,
+			"store":   s.store.Name(),
+		})
+	}
+	fmt.Printf("Logged in as %s on %s (session saved to %s)\n", user.Email, s.profile.BackendURL, s.store.Name())
+	return nil
+}
+
+// prompt reads one line, without echo when secret and stdin is a terminal.
+func prompt(r *bufio.Reader, label string, secret bool) (string, error) {
+	interactive := term.IsTerminal(os.Stdin.Fd())
+	if interactive {
+		fmt.Fprint(os.Stderr, label)
+	}
+	if secret && interactive {
+		data, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		return string(data), err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", usageError("missing " + strings.ToLower(strings.TrimSuffix(label, ": ")))
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ---- feeds ----
+
+func cmdFeeds(ctx context.Context, s *startup, args []string) error {
+	if len(args) == 0 {
+		return usageError("feeds needs a subcommand: list, get, create, update or delete")
+	}
+	// Each subcommand checks the session after its flags, so --help works logged out
+	switch args[0] {
+	case "list", "ls":
+		return cmdFeedsList(ctx, s, args[1:])
+	case "get", "show":
+		return cmdFeedsGet(ctx, s, args[1:])
+	case "create":
+		return cmdFeedsCreate(ctx, s, args[1:])
+	case "update":
+		return cmdFeedsUpdate(ctx, s, args[1:])
+	case "delete", "rm":
+		return cmdFeedsDelete(ctx, s, args[1:])
+	}
+	return usageError(fmt.Sprintf("unknown feeds subcommand %q", args[0]))
+}
+
+func cmdFeedsList(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("feeds list")
+	mine := fs.Bool("mine", false, "only feeds you own")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return usageError("feeds list takes no arguments")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+
+	var feeds []api.Feed
+	if *mine {
+		feeds, err = s.client.MyFeeds(ctx)
+	} else {
+		feeds, err = s.client.ListFeeds(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		if feeds == nil {
+			feeds = []api.Feed{}
+		}
+		return printJSON(feeds)
+	}
+	rows := make([][]string, 0, len(feeds))
+	for _, f := range feeds {
+		rows = append(rows, []string{f.ID, f.Name, f.Category, strconv.Itoa(f.SubscriberCount), f.OwnerName})
+	}
+	return printTable([]string{"ID", "NAME", "CATEGORY", "SUBSCRIBERS", "OWNER"}, rows)
+}
+
+func cmdFeedsGet(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("feeds get")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("usage: feeds get FEED")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return printFeed(feed, *format)
+}
+
+func printFeed(feed *api.Feed, format string) error {
+	if format == "json" {
+		return printJSON(feed)
+	}
+	return printTable([]string{"FIELD", "VALUE"}, [][]string{
+		{"ID", feed.ID},
+		{"Name", feed.Name},
+		{"Description", feed.Description},
+		{"URL", feed.URL},
+		{"Category", feed.Category},
+		{"Event", feed.EventName},
+		{"Owner", feed.OwnerName},
+		{"Subscribers", strconv.Itoa(feed.SubscriberCount)},
+		{"Active", strconv.FormatBool(feed.IsActive)},
+		{"System prompt", feed.SystemPrompt},
+	})
+}
+
+// feedField is an editable feed field exposed as a flag.
+type feedField struct {
+	flag  string // command-line name
+	field string // API name
+	value *string
+}
+
+type feedFlags []feedField
+
+func newFeedFlags(fs *flag.FlagSet) feedFlags {
+	defs := []struct{ flag, field, usage string }{
+		{"name", "name", "feed name"},
+		{"description", "description", "what the feed carries"},
+		{"url", "url", "source WebSocket URL"},
+		{"category", "category", "marketplace category"},
+		{"event", "eventName", "event name to listen for"},
+		{"connection-message", "connectionMessages", "message sent to the source after connecting"},
+		{"system-prompt", "systemPrompt", "system prompt for AI analysis"},
+	}
+	fields := make(feedFlags, 0, len(defs))
+	for _, def := range defs {
+		fields = append(fields, feedField{flag: def.flag, field: def.field, value: fs.String(def.flag, "", def.usage)})
+	}
+	return fields
+}
+
+func (f feedFlags) get(field string) string {
+	for _, ff := range f {
+		if ff.field == field {
+			return *ff.value
+		}
+	}
+	return ""
+}
+
+// updates returns only the fields given on the command line.
+func (f feedFlags) updates(fs *flag.FlagSet) map[string]interface{} {
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	out := map[string]interface{}{}
+	for _, ff := range f {
+		switch {
+		case !set[ff.flag]:
+		case ff.field == "connectionMessages":
+			out[ff.field] = []string{*ff.value}
+		default:
+			out[ff.field] = *ff.value
+		}
+	}
+	return out
+}
+
+func cmdFeedsCreate(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("feeds create")
+	fields := newFeedFlags(fs)
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return usageError("feeds create takes flags only, e.g. --name N --url U")
+	}
+	if fields.get("name") == "" || fields.get("url") == "" {
+		return usageError("feeds create needs --name and --url")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.client.CreateFeed(ctx, fields.get("name"), fields.get("description"), fields.get("url"),
+		fields.get("category"), fields.get("eventName"), fields.get("connectionMessages"), fields.get("systemPrompt"))
+	if err != nil {
+		return err
+	}
+	return printFeed(feed, *format)
+}
+
+func cmdFeedsUpdate(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("feeds update")
+	fields := newFeedFlags(fs)
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("usage: feeds update FEED [--name N] [--url U] ...")
+	}
+	updates := fields.updates(fs)
+	if len(updates) == 0 {
+		return usageError("feeds update needs at least one field flag")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	updated, err := s.client.UpdateFeed(ctx, feed.ID, updates)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		updated = feed
+	}
+	return printFeed(updated, *format)
+}
+
+func cmdFeedsDelete(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("feeds delete")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("usage: feeds delete FEED")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if err := s.client.DeleteFeed(ctx, feed.ID); err != nil {
+		return err
+	}
+	return printResult(*format, "deleted", feed)
+}
+
+// printResult reports a completed action on a feed.
+func printResult(format, action string, feed *api.Feed) error {
+	if format == "json" {
+		return printJSON(map[string]string{"action": action, "feedId": feed.ID, "feedName": feed.Name})
+	}
+	fmt.Printf("%s %s (%s)\n", strings.ToUpper(action[:1])+action[1:], feed.Name, feed.ID)
+	return nil
+}
+
+// ---- subs ----
+
+func cmdSubs(ctx context.Context, s *startup, args []string) error {
+	if len(args) == 0 {
+		return usageError("subs needs a subcommand: list, add or rm")
+	}
+	// Each subcommand checks the session after its flags, so --help works logged out
+	switch args[0] {
+	case "list", "ls":
+		return cmdSubsList(ctx, s, args[1:])
+	case "add":
+		return cmdSubsChange(ctx, s, "subscribed", args[1:])
+	case "rm", "remove":
+		return cmdSubsChange(ctx, s, "unsubscribed", args[1:])
+	}
+	return usageError(fmt.Sprintf("unknown subs subcommand %q", args[0]))
+}
+
+func cmdSubsList(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("subs list")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return usageError("subs list takes no arguments")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	subs, err := s.client.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		if subs == nil {
+			subs = []api.Subscription{}
+		}
+		return printJSON(subs)
+	}
+
+	// Subscriptions only carry IDs; show names when the feed list is available
+	names := map[string]string{}
+	if feeds, err := s.client.ListFeeds(ctx); err == nil {
+		for _, f := range feeds {
+			names[f.ID] = f.Name
+		}
+	}
+	rows := make([][]string, 0, len(subs))
+	for _, sub := range subs {
+		rows = append(rows, []string{sub.FeedID, names[sub.FeedID], sub.Subscribed, strconv.FormatBool(sub.IsActive)})
+	}
+	return printTable([]string{"FEED ID", "NAME", "SUBSCRIBED", "ACTIVE"}, rows)
+}
+
+func cmdSubsChange(ctx context.Context, s *startup, action string, args []string) error {
+	fs := newFlagSet("subs")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("usage: subs add|rm FEED")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if action == "subscribed" {
+		err = s.client.Subscribe(ctx, feed.ID)
+	} else {
+		err = s.client.Unsubscribe(ctx, feed.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return printResult(*format, action, feed)
+}
+
+// ---- Streaming commands ----
+
+// cliStream is a socket opened for a headless command, with its messages
+// delivered on channels instead of through the Bubble Tea loop.
+type cliStream struct {
+	ws      *wsClient
+	ingest  *ingestor
+	msgs    <-chan tea.Msg // status, acks and AI frames
+	batches <-chan tea.Msg // feed-data batches
+}
+
+// openStream connects the socket as the session's user. Call requireSession first.
+func (s *startup) openStream(ctx context.Context) (*cliStream, error) {
+	user, err := s.client.Me(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ingest := newIngestor(s.profile.ingestConfig(), NewMetricsCollector())
+	ws, err := dialWS(s.profile.WSURL, user.ID, cliUserAgent, wsOptions{
+		Token:      s.token,
+		Reconnect:  reconnectPolicyFromEnv(),
+		Heartbeat:  heartbeatPolicyFromEnv(),
+		AckTimeout: getenvDuration("TURBOSTREAM_WS_ACK_TIMEOUT", 10*time.Second),
+		Framing:    framingConfigFromEnv(),
+		Transport:  s.transport,
+		Ingest:     ingest,
+		Inspector:  newProtocolInspector(100),
+	})
+	if err != nil {
+		ingest.Close()
+		return nil, fmt.Errorf("connect %s: %w", s.profile.WSURL, err)
+	}
+	return &cliStream{
+		ws:      ws,
+		ingest:  ingest,
+		msgs:    listen(ws.ListenCmd),
+		batches: listen(ingest.ListenCmd),
+	}, nil
+}
+
+func (st *cliStream) Close() {
+	st.ws.Close()
+	st.ingest.Close()
+}
+
+// listen turns a listen command into a channel that closes when the source does.
+func listen(next func() tea.Cmd) <-chan tea.Msg {
+	ch := make(chan tea.Msg)
+	go func() {
+		defer close(ch)
+		for {
+			msg := next()()
+			if msg == nil {
+				return
+			}
+			ch <- msg
+		}
+	}()
+	return ch
+}
+
+// connectionError turns socket status messages into a command failure. It
+// returns nil for messages that don't end the command.
+func connectionError(msg tea.Msg) error {
+	switch msg := msg.(type) {
+	case wsAuthFailedMsg:
+		return msg.Err
+	case wsStatusMsg:
+		if msg.Status == "reconnecting" && msg.Err != nil {
+			fmt.Fprintf(os.Stderr, "connection lost (%v); reconnecting (attempt %d)\n", msg.Err, msg.Attempt)
+		}
+		if msg.Status == "disconnected" && msg.Err != nil {
+			return fmt.Errorf("%w: %v", errStreamLost, msg.Err)
+		}
+	}
+	return nil
+}
+
+// ---- tail ----
+
+// tailEvent is one NDJSON line printed by tail.
+type tailEvent struct {
+	FeedID   string          `json:"feedId"`
+	FeedName string          `json:"feedName,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Seq      int64           `json:"seq,omitempty"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func cmdTail(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("tail")
+	count := fs.Int("n", 0, "exit after this many events (0 = until interrupted)")
+	format := outputFlag(fs, "json")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("usage: tail FEED [-n COUNT]")
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	stream, err := s.openStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	stream.ws.Subscribe(feed.ID)
+
+	enc := json.NewEncoder(os.Stdout)
+	printed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			// Ctrl+C is how tail normally ends; it still exits 130 like ask
+			return ctx.Err()
+		case msg, ok := <-stream.msgs:
+			if !ok {
+				return errStreamLost
+			}
+			switch msg := msg.(type) {
+			case wsCommandResultMsg:
+				if msg.Err != nil && msg.Action == "subscribe" {
+					return fmt.Errorf("subscribe %s: %w", feed.Name, msg.Err)
+				}
+			case feedGapMsg:
+				fmt.Fprintf(os.Stderr, "warning: %d events lost between %s and %s\n",
+					msg.Missed, msg.From.Format(time.RFC3339), msg.To.Format(time.RFC3339))
+			default:
+				if err := connectionError(msg); err != nil {
+					return err
+				}
+			}
+		case msg := <-stream.batches:
+			batch, ok := msg.(feedBatchMsg)
+			if !ok {
+				continue
+			}
+			for _, ev := range batch.Feeds[feed.ID] {
+				if err := printTailEvent(enc, ev, *format); err != nil {
+					return err
+				}
+				printed++
+				if *count > 0 && printed >= *count {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func printTailEvent(enc *json.Encoder, ev feedDataMsg, format string) error {
+	if format == "table" {
+		ts := ev.Time
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		_, err := fmt.Printf("%s  %-16s %s\n", ts.Format("15:04:05.000"), ev.EventName, ev.Data)
+		return err
+	}
+	data := json.RawMessage(ev.Data)
+	if !json.Valid(data) {
+		data, _ = json.Marshal(ev.Data)
+	}
+	return enc.Encode(tailEvent{
+		FeedID:   ev.FeedID,
+		FeedName: ev.FeedName,
+		Event:    ev.EventName,
+		Seq:      ev.Seq,
+		Time:     ev.Time,
+		Data:     data,
+	})
+}
+
+// ---- ask ----
+
+func cmdAsk(ctx context.Context, s *startup, args []string) error {
+	fs := newFlagSet("ask")
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up waiting for the answer after this long")
+	format := outputFlag(fs, "table")
+	pos, err := parseArgs(fs, args, format)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 || strings.TrimSpace(pos[1]) == "" {
+		return usageError(`usage: ask FEED "QUESTION"`)
+	}
+	if err := s.requireSession(ctx); err != nil {
+		return err
+	}
+	feed, err := s.resolveFeed(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	stream, err := s.openStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Queries sent before registration completes may be dropped by the backend
+	if err := waitRegistered(ctx, stream); err != nil {
+		return err
+	}
+	requestID := fmt.Sprintf("req-%d", time.Now().UnixNano())
+	if err := stream.ws.SendLLMQuery(feed.ID, pos[1], feed.SystemPrompt, requestID, ""); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	deadline := time.NewTimer(*timeout)
+	defer deadline.Stop()
+	var answer strings.Builder
+	for {
+		select {
+		case <-ctx.Done():
+			_ = stream.ws.CancelLLMQuery(requestID)
+			return ctx.Err()
+		case <-deadline.C:
+			_ = stream.ws.CancelLLMQuery(requestID)
+			return fmt.Errorf("no answer after %s", *timeout)
+		case <-stream.batches:
+			// feed-data for other subscriptions; not needed here
+		case msg, ok := <-stream.msgs:
+			if !ok {
+				return errStreamLost
+			}
+			switch msg := msg.(type) {
+			case aiTokenMsg:
+				if msg.RequestID != requestID {
+					continue
+				}
+				answer.WriteString(msg.Token)
+				if *format == "json" {
+					if err := enc.Encode(map[string]string{"type": "token", "requestId": requestID, "token": msg.Token}); err != nil {
+						return err
+					}
+				} else {
+					fmt.Print(msg.Token)
+				}
+			case aiResponseMsg:
+				if msg.RequestID != requestID {
+					continue
+				}
+				if msg.Err != nil {
+					if answer.Len() > 0 && *format != "json" {
+						fmt.Println()
+					}
+					return msg.Err
+				}
+				return printAnswer(enc, *format, requestID, feed, msg, answer.String())
+			case aiCancelledMsg:
+				if msg.RequestID == requestID {
+					return fmt.Errorf("request cancelled: %w", context.Canceled)
+				}
+			default:
+				if err := connectionError(msg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// waitRegistered waits for registration-success on a new socket. Backends
+// that never send it get a short grace period instead.
+func waitRegistered(ctx context.Context, stream *cliStream) error {
+	grace := time.NewTimer(5 * time.Second)
+	defer grace.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-grace.C:
+			return nil
+		case msg, ok := <-stream.msgs:
+			if !ok {
+				return errStreamLost
+			}
+			if status, isStatus := msg.(wsStatusMsg); isStatus && status.Status == "connected" {
+				return nil
+			}
+			if err := connectionError(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func printAnswer(enc *json.Encoder, format, requestID string, feed *api.Feed, msg aiResponseMsg, streamed string) error {
+	text := msg.Answer
+	if text == "" {
+		text = streamed
+	}
+	if format == "json" {
+		return enc.Encode(map[string]interface{}{
+			"type":       "complete",
+			"requestId":  requestID,
+			"feedId":     feed.ID,
+			"answer":     text,
+			"provider":   msg.Provider,
+			"durationMs": msg.Duration,
+		})
+	}
+	if streamed == "" {
+		// Non-streaming backends only send the final answer
+		fmt.Print(text)
+	}
+	fmt.Println()
+	return nil
+}
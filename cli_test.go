@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantN     int
+		wantFmt   string
+		wantUsage bool
+		wantHelp  bool
+	}{
+		{"flags first", []string{"--output", "json", "feed-1"}, []string{"feed-1"}, 0, "json", false, false},
+		{"flags last", []string{"feed-1", "-o", "json"}, []string{"feed-1"}, 0, "json", false, false},
+		{"flags between", []string{"feed-1", "-n", "5", "why?"}, []string{"feed-1", "why?"}, 5, "table", false, false},
+		{"no arguments", nil, nil, 0, "table", false, false},
+		{"terminator", []string{"feed-1", "--", "-n", "--output"}, []string{"feed-1", "-n", "--output"}, 0, "table", false, false},
+		{"flags before the terminator", []string{"-n", "2", "--", "-x"}, []string{"-x"}, 2, "table", false, false},
+		{"terminator last", []string{"feed-1", "--"}, []string{"feed-1"}, 0, "table", false, false},
+		{"unknown flag", []string{"--bogus"}, nil, 0, "", true, false},
+		{"missing flag value", []string{"feed-1", "-n"}, nil, 0, "", true, false},
+		{"unknown output format", []string{"-o", "yaml"}, nil, 0, "", true, false},
+		{"help", []string{"feed-1", "--help"}, nil, 0, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			n := fs.Int("n", 0, "count")
+			format := outputFlag(fs, "table")
+
+			got, err := parseArgs(fs, tt.args, format)
+			var usage usageError
+			if errors.As(err, &usage) != tt.wantUsage || errors.Is(err, flag.ErrHelp) != tt.wantHelp {
+				t.Fatalf("parseArgs error = %v, want usage %v, help %v", err, tt.wantUsage, tt.wantHelp)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positional = %q, want %q", got, tt.want)
+			}
+			if *n != tt.wantN || *format != tt.wantFmt {
+				t.Errorf("-n %d --output %s, want -n %d --output %s", *n, *format, tt.wantN, tt.wantFmt)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	body := api.ErrorBody{StatusCode: 400, Message: "x"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"interrupted", context.Canceled, exitInterrupted},
+		{"interrupted while waiting", fmt.Errorf("request cancelled: %w", context.Canceled), exitInterrupted},
+		{"usage", usageError("usage: feeds get FEED"), exitUsage},
+		{"not logged in", errNotLoggedIn, exitAuth},
+		{"session expired", fmt.Errorf("session expired: %w", errNotLoggedIn), exitAuth},
+		{"token rejected", &api.AuthRequiredError{ErrorBody: body}, exitAuth},
+		{"two-factor code needed", &api.TwoFactorRequiredError{ErrorBody: body}, exitAuth},
+		{"forbidden", &api.ForbiddenError{ErrorBody: body}, exitAuth},
+		{"socket rejected the session", fmt.Errorf("dial: %w", errWSAuth), exitAuth},
+		{"feed not found", fmt.Errorf("feed %q: %w", "x", &api.NotFoundError{ErrorBody: body}), exitNotFound},
+		{"invalid input", &api.ValidationError{ErrorBody: body}, exitInvalid},
+		{"rate limited", &api.RateLimitedError{ErrorBody: body}, exitUnavailable},
+		{"server error", &api.ServerError{ErrorBody: body}, exitUnavailable},
+		{"backend unreachable", &url.Error{Op: "Get", URL: "http://localhost:7210", Err: &net.OpError{Op: "dial"}}, exitUnavailable},
+		{"stream lost", fmt.Errorf("%w: EOF", errStreamLost), exitUnavailable},
+		{"other backend error", &api.RequestError{ErrorBody: body}, exitError},
+		{"anything else", errors.New("boom"), exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// Help must not need a session: flags are parsed before it is checked.
+func TestCommandHelpLoggedOut(t *testing.T) {
+	s := &startup{}
+	tests := []struct {
+		name string
+		run  func(context.Context, *startup, []string) error
+		args []string
+	}{
+		{"feeds list", cmdFeeds, []string{"list", "--help"}},
+		{"feeds get", cmdFeeds, []string{"get", "-h"}},
+		{"feeds create", cmdFeeds, []string{"create", "--help"}},
+		{"feeds update", cmdFeeds, []string{"update", "--help"}},
+		{"feeds delete", cmdFeeds, []string{"delete", "--help"}},
+		{"subs list", cmdSubs, []string{"list", "--help"}},
+		{"subs add", cmdSubs, []string{"add", "--help"}},
+		{"subs rm", cmdSubs, []string{"rm", "-h"}},
+		{"tail", cmdTail, []string{"--help"}},
+		{"ask", cmdAsk, []string{"--help"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(context.Background(), s, tt.args); !errors.Is(err, flag.ErrHelp) {
+				t.Errorf("error = %v, want flag.ErrHelp", err)
+			}
+		})
+	}
+
+	if err := cmdFeeds(context.Background(), s, []string{"list"}); !errors.Is(err, errNotLoggedIn) {
+		t.Errorf("feeds list logged out: error = %v, want errNotLoggedIn", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// appConfig is the optional config file with named backend profiles:
+//
+//	default_profile: local
+//	profiles:
+//	  local:
+//	    backend_url: http://localhost:7210
+//	    ws_url: ws://localhost:7210/ws
+//	  prod:
+//	    backend_url: https://api.turbostream.example
+//	    ws_url: wss://api.turbostream.example/ws
+//	    email: me@example.com
+//	    ai_interval: 30
+//	    theme: amber
+type appConfig struct {
+	DefaultProfile string                   `yaml:"default_profile"`
+	Profiles       map[string]profileConfig `yaml:"profiles"`
+
+	path string
+}
+
+// profileConfig holds the settings for one backend. Zero fields fall back to
+// the environment variables, then to the built-in defaults.
+type profileConfig struct {
+	BackendURL    string        `yaml:"backend_url"`
+	WSURL         string        `yaml:"ws_url"`
+	Email         string        `yaml:"email"`
+	AIInterval    int           `yaml:"ai_interval"`    // seconds between auto queries
+	IngestBuffer  int           `yaml:"ingest_buffer"`  // events buffered per feed
+	FrameInterval time.Duration `yaml:"frame_interval"` // e.g. 50ms
+	Theme         string        `yaml:"theme"`
+
+	PayloadOutlierBytes int `yaml:"payload_outlier_bytes"` // flag larger payloads; -1 disables
+}
+
+// configPath is TURBOSTREAM_CONFIG, or config.yaml in the user config directory.
+func configPath() string {
+	if p := getenvDefault("TURBOSTREAM_CONFIG", ""); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "turbostream", "config.yaml")
+}
+
+// loadConfig reads the config file. A missing file is not an error; the
+// result then has no profiles and everything comes from the environment.
+func loadConfig(path string) (*appConfig, error) {
+	cfg := &appConfig{path: path}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.DefaultProfile != "" {
+		if _, ok := cfg.Profiles[cfg.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("%s: default_profile %q is not defined", path, cfg.DefaultProfile)
+		}
+	}
+	return cfg, nil
+}
+
+// Names returns the profile names in a stable order.
+func (c *appConfig) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select picks the profile to start with: the requested one, else
+// default_profile, else the only profile. An empty name with an empty
+// profile means no config file is in use.
+func (c *appConfig) Select(name string) (string, profileConfig, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" && len(c.Profiles) == 1 {
+		name = c.Names()[0]
+	}
+	if name == "" {
+		return "", profileConfig{}, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return "", profileConfig{}, fmt.Errorf("profile %q not found in %s", name, c.path)
+	}
+	return name, p, nil
+}
+
+// resolve fills unset fields from the environment and defaults.
+func (p profileConfig) resolve() profileConfig {
+	if p.BackendURL == "" {
+		p.BackendURL = getenvDefault("TURBOSTREAM_BACKEND_URL", "http://localhost:7210")
+	}
+	if p.WSURL == "" {
+		p.WSURL = getenvDefault("TURBOSTREAM_WEBSOCKET_URL", "ws://localhost:7210/ws")
+	}
+	if p.Email == "" {
+		p.Email = os.Getenv("TURBOSTREAM_EMAIL")
+	}
+	if p.AIInterval <= 0 {
+		p.AIInterval = getenvInt("TURBOSTREAM_AI_INTERVAL", 10)
+	}
+	ingest := ingestConfigFromEnv()
+	if p.IngestBuffer <= 0 {
+		p.IngestBuffer = ingest.BufferSize
+	}
+	if p.FrameInterval <= 0 {
+		p.FrameInterval = ingest.FrameInterval
+	}
+	if p.Theme == "" {
+		p.Theme = getenvDefault("TURBOSTREAM_THEME", defaultTheme)
+	}
+	if p.PayloadOutlierBytes == 0 {
+		p.PayloadOutlierBytes = getenvInt("TURBOSTREAM_PAYLOAD_OUTLIER_BYTES", defaultPayloadOutlierBytes)
+	}
+	return p
+}
+
+// ingestConfig applies the profile's buffer settings to the env defaults.
+func (p profileConfig) ingestConfig() ingestConfig {
+	c := ingestConfigFromEnv()
+	c.BufferSize = p.IngestBuffer
+	c.FrameInterval = p.FrameInterval
+	return c
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `default_profile: local
+profiles:
+  local:
+    backend_url: http://localhost:7210
+  prod:
+    backend_url: https://api.turbostream.example
+    ws_url: wss://api.turbostream.example/ws
+    email: me@example.com
+    ai_interval: 30
+    frame_interval: 50ms
+    theme: amber
+`
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantErr      bool
+		wantProfiles int
+	}{
+		{"no path", "", false, 0},
+		{"missing file", filepath.Join(dir, "missing.yaml"), false, 0},
+		{"profiles", write("ok.yaml", testConfig), false, 2},
+		{"empty file", write("empty.yaml", ""), false, 0},
+		{"not YAML", write("bad.yaml", "profiles: [\n"), true, 0},
+		{"undefined default", write("nodefault.yaml", "default_profile: prod\nprofiles:\n  local: {}\n"), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(cfg.Profiles) != tt.wantProfiles {
+				t.Errorf("%d profiles, want %d", len(cfg.Profiles), tt.wantProfiles)
+			}
+		})
+	}
+
+	cfg, err := loadConfig(filepath.Join(dir, "ok.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := cfg.Profiles["prod"]
+	if prod.AIInterval != 30 || prod.FrameInterval != 50*time.Millisecond || prod.Theme != "amber" {
+		t.Errorf("prod profile = %+v", prod)
+	}
+}
+
+func TestConfigSelect(t *testing.T) {
+	two := &appConfig{DefaultProfile: "local", Profiles: map[string]profileConfig{
+		"local": {BackendURL: "http://localhost:7210"},
+		"prod":  {BackendURL: "https://api.turbostream.example"},
+	}}
+	noDefault := &appConfig{Profiles: two.Profiles}
+	one := &appConfig{Profiles: map[string]profileConfig{"only": {BackendURL: "http://only"}}}
+
+	tests := []struct {
+		name        string
+		cfg         *appConfig
+		requested   string
+		wantName    string
+		wantBackend string
+		wantErr     bool
+	}{
+		{"requested wins over default", two, "prod", "prod", "https://api.turbostream.example", false},
+		{"default profile", two, "", "local", "http://localhost:7210", false},
+		{"only profile", one, "", "only", "http://only", false},
+		{"several profiles, no default", noDefault, "", "", "", false},
+		{"no config file", &appConfig{}, "", "", "", false},
+		{"unknown profile", two, "staging", "", "", true},
+		{"profile without a config file", &appConfig{}, "prod", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, p, err := tt.cfg.Select(tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select(%q) error = %v, wantErr %v", tt.requested, err, tt.wantErr)
+			}
+			if name != tt.wantName || p.BackendURL != tt.wantBackend {
+				t.Errorf("Select(%q) = %q (%s), want %q (%s)", tt.requested, name, p.BackendURL, tt.wantName, tt.wantBackend)
+			}
+		})
+	}
+}
+
+func TestProfileResolve(t *testing.T) {
+	env := map[string]string{
+		"TURBOSTREAM_BACKEND_URL":           "https://env.example",
+		"TURBOSTREAM_WEBSOCKET_URL":         "wss://env.example/ws",
+		"TURBOSTREAM_EMAIL":                 "env@example.com",
+		"TURBOSTREAM_AI_INTERVAL":           "20",
+		"TURBOSTREAM_INGEST_BUFFER":         "256",
+		"TURBOSTREAM_UI_FRAME_INTERVAL":     "200ms",
+		"TURBOSTREAM_THEME":                 "green",
+		"TURBOSTREAM_PAYLOAD_OUTLIER_BYTES": "1024",
+	}
+	defaults := profileConfig{
+		BackendURL:          "http://localhost:7210",
+		WSURL:               "ws://localhost:7210/ws",
+		AIInterval:          10,
+		IngestBuffer:        defaultIngestConfig().BufferSize,
+		FrameInterval:       defaultIngestConfig().FrameInterval,
+		Theme:               defaultTheme,
+		PayloadOutlierBytes: defaultPayloadOutlierBytes,
+	}
+	fromEnv := profileConfig{
+		BackendURL:          "https://env.example",
+		WSURL:               "wss://env.example/ws",
+		Email:               "env@example.com",
+		AIInterval:          20,
+		IngestBuffer:        256,
+		FrameInterval:       200 * time.Millisecond,
+		Theme:               "green",
+		PayloadOutlierBytes: 1024,
+	}
+	profile := profileConfig{
+		BackendURL:          "https://profile.example",
+		WSURL:               "wss://profile.example/ws",
+		Email:               "profile@example.com",
+		AIInterval:          30,
+		IngestBuffer:        4096,
+		FrameInterval:       50 * time.Millisecond,
+		Theme:               "amber",
+		PayloadOutlierBytes: -1,
+	}
+
+	tests := []struct {
+		name    string
+		env     bool
+		profile profileConfig
+		want    profileConfig
+	}{
+		{"built-in defaults", false, profileConfig{}, defaults},
+		{"environment over defaults", true, profileConfig{}, fromEnv},
+		{"profile over environment", true, profile, profile},
+		{"profile over defaults", false, profile, profile},
+		{"unset profile fields fall through", true, profileConfig{BackendURL: "https://profile.example", Theme: "amber"},
+			profileConfig{
+				BackendURL:          "https://profile.example",
+				WSURL:               "wss://env.example/ws",
+				Email:               "env@example.com",
+				AIInterval:          20,
+				IngestBuffer:        256,
+				FrameInterval:       200 * time.Millisecond,
+				Theme:               "amber",
+				PayloadOutlierBytes: 1024,
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range env {
+				if !tt.env {
+					value = ""
+				}
+				t.Setenv(key, value)
+			}
+			if got := tt.profile.resolve(); got != tt.want {
+				t.Errorf("resolve() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
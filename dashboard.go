@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -47,6 +48,7 @@ var (
 // renderSparkline renders a sparkline chart from data values
 // width determines how many of the most recent values to show
 // invertColor: if true, higher values are red (bad), if false, higher values are green (good)
+// NaN values (no samples, e.g. before a feed was watched) are drawn as gray gaps
 func renderSparkline(data []float64, width int, invertColor bool) string {
 	if len(data) == 0 {
 		return strings.Repeat("▁", width)
@@ -60,7 +62,7 @@ func renderSparkline(data []float64, width int, invertColor bool) string {
 	values := data[start:]
 
 	// Find min/max for scaling
-	minVal, maxVal := values[0], values[0]
+	minVal, maxVal := math.Inf(1), math.Inf(-1)
 	for _, v := range values {
 		if v < minVal {
 			minVal = v
@@ -73,6 +75,10 @@ func renderSparkline(data []float64, width int, invertColor bool) string {
 	// Build sparkline
 	var sb strings.Builder
 	for _, v := range values {
+		if math.IsNaN(v) {
+			sb.WriteString(lipgloss.NewStyle().Foreground(grayColor).Render("▁"))
+			continue
+		}
 		// Normalize to 0-7 (8 levels)
 		level := 0
 		if maxVal > minVal {
@@ -269,6 +275,9 @@ func renderDashboardView(dm DashboardMetrics, termWidth, termHeight int) string
 	}
 	title := fmt.Sprintf("%s  %s", fm.Name, statusStyle.Render(statusIcon))
 	contentBuilder.WriteString(lipgloss.NewStyle().Bold(true).Foreground(cyanColor).Render(title))
+	if dm.Range != "" {
+		contentBuilder.WriteString(metricLabelStyle.Render("   trends: last " + dm.Range))
+	}
 	contentBuilder.WriteString("\n")
 
 	// Summary bar
@@ -295,7 +304,7 @@ func renderDashboardView(dm DashboardMetrics, termWidth, termHeight int) string
 	contentBuilder.WriteString("\n")
 
 	// Middle row: Payload Histogram | LLM Usage
-	payloadPanel := renderPayloadPanel(fm, panelWidth)
+	payloadPanel := renderPayloadPanel(fm, dm.SelectedOutlier, panelWidth)
 	llmPanel := renderLLMPanel(fm, panelWidth)
 
 	if contentWidth >= 72 {
@@ -310,7 +319,11 @@ func renderDashboardView(dm DashboardMetrics, termWidth, termHeight int) string
 	mainView := lipgloss.JoinHorizontal(lipgloss.Top, sidebar, "  ", contentBuilder.String())
 
 	// Help line
-	helpLine := helpStyle.Render("↑/↓: select feed | Tab: switch tab | q: quit")
+	help := "↑/↓: select feed | o: open stream | Tab: switch tab | q: quit"
+	if dm.Range != "" {
+		help = "↑/↓: select feed | t: trend range | o: open stream | Tab: switch tab | q: quit"
+	}
+	helpLine := helpStyle.Render(help)
 
 	return lipgloss.JoinVertical(lipgloss.Left, mainView, "", helpLine)
 }
@@ -439,7 +452,8 @@ func renderSummaryBar(fm FeedMetrics, width int) string {
 	cacheInfo := fmt.Sprintf("ctx: %d items", fm.CacheItemsCurrent)
 
 	// LLM tokens
-	tokens := fmt.Sprintf("in: %d out: %d", fm.InputTokensLast, fm.OutputTokensLast)
+	est := fm.TokenEstimator != ""
+	tokens := fmt.Sprintf("in: %s out: %s", tokenCount(fm.InputTokensLast, est), tokenCount(fm.OutputTokensLast, est))
 
 	// Generation time
 	genTime := fmt.Sprintf("gen: %.0fms", fm.GenerationTimeAvgMs)
@@ -483,6 +497,17 @@ func renderStreamHealthPanel(fm FeedMetrics, width int) string {
 	// Total bytes
 	lines = append(lines, renderMetric("Total Bytes", humanizeBytes(fm.BytesReceivedTotal)))
 
+	// Wire bytes vs decoded bytes of the whole connection: savings from
+	// permessage-deflate. Backend feeds share one socket and one total.
+	if conn := fm.Connection; conn.CompressionRatio > 0 {
+		label := "Socket Wire"
+		if conn.Name == backendConnection {
+			label = "Backend Wire"
+		}
+		lines = append(lines, renderMetric(label, fmt.Sprintf("%s (%.1fx)",
+			humanizeBytes(conn.WireBytesTotal), conn.CompressionRatio)))
+	}
+
 	// Last message age
 	ageStyle := goodValueStyle
 	if fm.LastMessageAgeSeconds > 30 {
@@ -494,6 +519,24 @@ func renderStreamHealthPanel(fm FeedMetrics, width int) string {
 	lines = append(lines, renderColoredMetric("Last Msg",
 		humanizeDuration(fm.LastMessageAgeSeconds)+" ago", ageStyle))
 
+	// Heartbeat: distinguishes a quiet feed from a dead socket
+	if fm.LastPongAgeSeconds < 0 {
+		lines = append(lines, renderMetric("Ping RTT", "n/a"))
+	} else {
+		rttStyle := colorByThreshold(fm.PingRTTMs, 250, 1000, false)
+		lines = append(lines, renderColoredMetric("Ping RTT",
+			fmt.Sprintf("%.0fms (avg %.0fms)", fm.PingRTTMs, fm.PingRTTAvgMs), rttStyle))
+		pongStyle := goodValueStyle
+		if fm.LastPongAgeSeconds > 30 {
+			pongStyle = warnValueStyle
+		}
+		if fm.LastPongAgeSeconds > 45 || !fm.WSConnected {
+			pongStyle = badValueStyle
+		}
+		lines = append(lines, renderColoredMetric("Last Pong",
+			humanizeDuration(fm.LastPongAgeSeconds)+" ago", pongStyle))
+	}
+
 	// Reconnects and uptime
 	lines = append(lines, renderMetric("Reconnects", fmt.Sprintf("%d", fm.ReconnectsTotal)))
 	lines = append(lines, renderMetric("Uptime", humanizeDuration(fm.CurrentUptimeSeconds)))
@@ -565,11 +608,20 @@ func renderCacheHealthPanel(fm FeedMetrics, width int) string {
 	}
 	lines = append(lines, renderColoredMetric("  Drop Rate", fmt.Sprintf("%.1f%%", fm.DropRatePercent), dropRateStyle))
 
+	// Stream gaps that could not be backfilled after a reconnect
+	gapStyle := goodValueStyle
+	if fm.GapsTotal > 0 {
+		gapStyle = badValueStyle
+	}
+	lines = append(lines, renderColoredMetric("  Gaps", fmt.Sprintf("%d (%d msgs, %s)",
+		fm.GapsTotal, fm.GapMessagesTotal, humanizeDuration(fm.GapSecondsTotal)), gapStyle))
+
 	return renderPanel("💾 LLM Context", strings.Join(lines, "\n"), width)
 }
 
-// renderPayloadPanel renders the payload size panel
-func renderPayloadPanel(fm FeedMetrics, width int) string {
+// renderPayloadPanel renders the payload size panel; selected is the
+// highlighted outlier, counted from the newest
+func renderPayloadPanel(fm FeedMetrics, selected, width int) string {
 	var lines []string
 
 	// Numeric stats
@@ -577,9 +629,141 @@ func renderPayloadPanel(fm FeedMetrics, width int) string {
 	lines = append(lines, renderMetric("Avg Payload", humanizeBytesInt(int(fm.PayloadSizeAvgBytes))))
 	lines = append(lines, renderMetric("Max Payload", humanizeBytesInt(fm.PayloadSizeMaxBytes)))
 
+	// Percentiles over the sampling window
+	lines = append(lines, renderMetric("Min / p50", fmt.Sprintf("%s / %s",
+		humanizeBytesInt(fm.PayloadSizeMinBytes), humanizeBytesInt(fm.PayloadSizeP50Bytes))))
+	lines = append(lines, renderMetric("p95 / p99", fmt.Sprintf("%s / %s",
+		humanizeBytesInt(fm.PayloadSizeP95Bytes), humanizeBytesInt(fm.PayloadSizeP99Bytes))))
+
+	// Average payload sparkline (neutral: size is neither good nor bad)
+	if len(fm.PayloadSizeHistory) > 0 {
+		sparkWidth := width - 12
+		if sparkWidth > 40 {
+			sparkWidth = 40
+		}
+		sparkline := renderSparkline(fm.PayloadSizeHistory, sparkWidth, false)
+		lines = append(lines, metricLabelStyle.Render("Trend: ")+sparkline)
+	}
+
+	// Size distribution on a log scale
+	if rows := renderPayloadHistogram(fm.PayloadSizeBuckets, width-4); len(rows) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, metricLabelStyle.Render("Distribution (last 5m):"))
+		lines = append(lines, rows...)
+	}
+
+	// Oversized payloads, newest first; their stream entries are marked ⚠
+	if fm.PayloadOutlierBytes > 0 {
+		lines = append(lines, "")
+		outlierStyle := goodValueStyle
+		if fm.PayloadOutliersTotal > 0 {
+			outlierStyle = warnValueStyle
+		}
+		lines = append(lines, renderColoredMetric("Outliers > "+humanizeBytesInt(fm.PayloadOutlierBytes),
+			fmt.Sprintf("%d", fm.PayloadOutliersTotal), outlierStyle))
+		for i := len(fm.PayloadOutliers) - 1; i >= 0; i-- {
+			o := fm.PayloadOutliers[i]
+			event := o.Event
+			if event == "" {
+				event = "-"
+			}
+			cursor := "  "
+			if len(fm.PayloadOutliers)-1-i == selected {
+				cursor = "▸ "
+			}
+			lines = append(lines, fmt.Sprintf("%s%s  %s  %s", cursor, o.Time.Format("15:04:05"),
+				truncate(event, 12), warnValueStyle.Render(humanizeBytesInt(o.Size))))
+		}
+		if len(fm.PayloadOutliers) > 0 {
+			lines = append(lines, metricLabelStyle.Render("  , .: select  o: show in stream"))
+		}
+	}
+
 	return renderPanel("Payload Size", strings.Join(lines, "\n"), width)
 }
 
+// maxHistogramRows caps the payload histogram; wider size ranges merge
+// neighbouring buckets.
+const maxHistogramRows = 8
+
+// renderPayloadHistogram draws power-of-two size buckets (see
+// payloadSampler.Buckets) as horizontal bars, one row per bucket from the
+// smallest to the largest size seen.
+func renderPayloadHistogram(buckets []int, width int) []string {
+	lo, hi := -1, -1
+	for i, n := range buckets {
+		if n > 0 {
+			if lo < 0 {
+				lo = i
+			}
+			hi = i
+		}
+	}
+	if lo < 0 {
+		return nil
+	}
+
+	// Merge 2, 4, ... buckets per row until the rows fit
+	per := 1
+	for (hi-lo)/per+1 > maxHistogramRows {
+		per *= 2
+	}
+	var counts, bounds []int
+	maxCount := 0
+	for start := lo; start <= hi; start += per {
+		n := 0
+		for i := start; i < start+per && i < len(buckets); i++ {
+			n += buckets[i]
+		}
+		counts = append(counts, n)
+		bounds = append(bounds, bucketLowerBound(start))
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+
+	barWidth := width - 16 // label, separator and count
+	if barWidth < 5 {
+		barWidth = 5
+	}
+	rows := make([]string, len(counts))
+	for i, n := range counts {
+		bar := 0
+		if n > 0 {
+			bar = n * barWidth / maxCount
+			if bar == 0 {
+				bar = 1
+			}
+		}
+		rows[i] = fmt.Sprintf("%s %s%s %s",
+			metricLabelStyle.Render(fmt.Sprintf("%6s", shortBytes(bounds[i]))+" │"),
+			sparklineCyanStyle.Render(strings.Repeat("█", bar)),
+			strings.Repeat(" ", barWidth-bar),
+			metricValueStyle.Render(fmt.Sprintf("%d", n)))
+	}
+	return rows
+}
+
+// bucketLowerBound is the smallest size in payload bucket i.
+func bucketLowerBound(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return 1 << (i - 1)
+}
+
+// shortBytes formats a power-of-two size compactly for histogram labels.
+func shortBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%dKB", n>>10)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
 // renderLLMPanel renders the LLM usage panel
 func renderLLMPanel(fm FeedMetrics, width int) string {
 	var lines []string
@@ -587,19 +771,42 @@ func renderLLMPanel(fm FeedMetrics, width int) string {
 	// Request counts
 	lines = append(lines, renderMetric("Total Requests", fmt.Sprintf("%d", fm.LLMRequestsTotal)))
 
-	// Token usage - Last request (most important)
+	if fm.LLMModel != "" {
+		lines = append(lines, renderMetric("Model", fm.LLMModel))
+	}
+
+	// Token usage - Last request (most important). Counts the backend didn't
+	// report are estimated locally and marked with "~".
+	est := fm.TokenEstimator != ""
 	lines = append(lines, "")
-	lines = append(lines, metricLabelStyle.Render("Last Request:"))
-	lines = append(lines, renderMetric("  Input Tokens", fmt.Sprintf("%d", fm.InputTokensLast)))
-	lines = append(lines, renderMetric("  Output Tokens", fmt.Sprintf("%d", fm.OutputTokensLast)))
+	if fm.TokenEstimator == heuristicEstimator {
+		// Tokenizer turned off: say how rough the counts are
+		lines = append(lines, metricLabelStyle.Render("Last Request (heuristic estimate):"))
+	} else if est {
+		lines = append(lines, metricLabelStyle.Render("Last Request (estimated, "+fm.TokenEstimator+"):"))
+	} else {
+		lines = append(lines, metricLabelStyle.Render("Last Request:"))
+	}
+	lines = append(lines, renderMetric("  Input Tokens", tokenCount(fm.InputTokensLast, est)))
+	lines = append(lines, renderMetric("  Output Tokens", tokenCount(fm.OutputTokensLast, est)))
+	if fm.CachedTokensLast > 0 {
+		lines = append(lines, renderMetric("  Cached Tokens", fmt.Sprintf("%d", fm.CachedTokensLast)))
+	}
 
 	// Token totals
+	totalEst := fm.EstimatedRequestsTotal > 0
 	lines = append(lines, "")
 	lines = append(lines, metricLabelStyle.Render("Session Totals:"))
-	lines = append(lines, renderMetric("  Input Tokens", fmt.Sprintf("%d", fm.InputTokensTotal)))
-	lines = append(lines, renderMetric("  Output Tokens", fmt.Sprintf("%d", fm.OutputTokensTotal)))
+	lines = append(lines, renderMetric("  Input Tokens", tokenCount(int(fm.InputTokensTotal), totalEst)))
+	lines = append(lines, renderMetric("  Output Tokens", tokenCount(int(fm.OutputTokensTotal), totalEst)))
 	totalTokens := fm.InputTokensTotal + fm.OutputTokensTotal
-	lines = append(lines, renderMetric("  Total Tokens", fmt.Sprintf("%d", totalTokens)))
+	lines = append(lines, renderMetric("  Total Tokens", tokenCount(int(totalTokens), totalEst)))
+	if fm.CachedTokensTotal > 0 {
+		lines = append(lines, renderMetric("  Cached Tokens", fmt.Sprintf("%d", fm.CachedTokensTotal)))
+	}
+	if totalEst {
+		lines = append(lines, renderColoredMetric("  Estimated", fmt.Sprintf("%d of %d requests", fm.EstimatedRequestsTotal, fm.LLMRequestsTotal), warnValueStyle))
+	}
 
 	// Events in context
 	lines = append(lines, "")
@@ -608,8 +815,11 @@ func renderLLMPanel(fm FeedMetrics, width int) string {
 	// Context utilization
 	ctxStyle := colorByThreshold(fm.ContextUtilizationPercent, 50, 80, false)
 	ctxBar := renderContextBar(fm.ContextUtilizationPercent, width-20)
-	lines = append(lines, renderColoredMetric("Context Usage",
-		fmt.Sprintf("%.1f%%", fm.ContextUtilizationPercent), ctxStyle))
+	ctxUsage := fmt.Sprintf("%.1f%%", fm.ContextUtilizationPercent)
+	if est {
+		ctxUsage = "~" + ctxUsage
+	}
+	lines = append(lines, renderColoredMetric("Context Usage", ctxUsage, ctxStyle))
 	lines = append(lines, ctxBar)
 
 	// Timing metrics - TTFT and Generation Time
@@ -657,10 +867,19 @@ func renderLLMPanel(fm FeedMetrics, width int) string {
 		errStyle = badValueStyle
 	}
 	lines = append(lines, renderColoredMetric("Errors", fmt.Sprintf("%d", fm.LLMErrorsTotal), errStyle))
+	lines = append(lines, renderMetric("Cancelled", fmt.Sprintf("%d", fm.LLMCancelledTotal)))
 
 	return renderPanel("LLM / Tokens", strings.Join(lines, "\n"), width)
 }
 
+// tokenCount formats a token count, prefixed with "~" when it is an estimate.
+func tokenCount(n int, estimated bool) string {
+	if estimated {
+		return fmt.Sprintf("~%d", n)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
 // renderContextBar renders a visual bar for context utilization
 func renderContextBar(percent float64, width int) string {
 	if width < 10 {
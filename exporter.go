@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedExport is one feed's metrics as the exporter publishes them.
+type feedExport struct {
+	FeedMetrics
+	LastMessage time.Time // zero until the first message
+	Payload     histogramSnapshot
+	TTFT        histogramSnapshot
+	GenTime     histogramSnapshot
+}
+
+type histogramSnapshot struct {
+	Bounds     []float64
+	Cumulative []uint64 // per bound, then +Inf
+	Sum        float64
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	if h == nil {
+		return histogramSnapshot{}
+	}
+	return histogramSnapshot{Bounds: h.bounds, Cumulative: h.Cumulative(), Sum: h.sum}
+}
+
+// Export returns every feed's metrics and histograms. Unlike GetMetrics it
+// doesn't advance the dashboard sparklines, so scrapes leave the UI alone.
+func (mc *MetricsCollector) Export() []feedExport {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	now := metricsClock()
+	feeds := make([]feedExport, 0, len(mc.feedMetrics))
+	for feedID, fm := range mc.feedMetrics {
+		feeds = append(feeds, feedExport{
+			FeedMetrics: mc.snapshotLocked(feedID, fm, now),
+			LastMessage: mc.lastMsgTimes[feedID],
+			Payload:     mc.payloadHist[feedID].snapshot(),
+			TTFT:        mc.ttftHist[feedID].snapshot(),
+			GenTime:     mc.genTimeHist[feedID].snapshot(),
+		})
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].FeedID < feeds[j].FeedID
+	})
+	return feeds
+}
+
+// promMetric is one metric family exposed per feed.
+type promMetric struct {
+	name  string
+	typ   string // "counter" or "gauge"
+	help  string
+	value func(f feedExport) (float64, bool) // false leaves the feed out
+}
+
+func always(fn func(f feedExport) float64) func(feedExport) (float64, bool) {
+	return func(f feedExport) (float64, bool) { return fn(f), true }
+}
+
+var promMetrics = []promMetric{
+	{"turbostream_feed_messages_received_total", "counter", "Messages received on the feed.",
+		always(func(f feedExport) float64 { return float64(f.MessagesReceivedTotal) })},
+	{"turbostream_feed_received_bytes_total", "counter", "Payload bytes received on the feed.",
+		always(func(f feedExport) float64 { return float64(f.BytesReceivedTotal) })},
+	{"turbostream_feed_messages_dropped_total", "counter", "Messages dropped before reaching the stream view or LLM context.",
+		always(func(f feedExport) float64 { return float64(f.MessagesDroppedTotal) })},
+	{"turbostream_feed_payload_outliers_total", "counter", "Payloads larger than the outlier threshold.",
+		always(func(f feedExport) float64 { return float64(f.PayloadOutliersTotal) })},
+	{"turbostream_feed_context_evictions_total", "counter", "Older messages evicted from the LLM context.",
+		always(func(f feedExport) float64 { return float64(f.ContextEvictionsTotal) })},
+	{"turbostream_feed_reconnects_total", "counter", "Times the feed's connection was lost.",
+		always(func(f feedExport) float64 { return float64(f.ReconnectsTotal) })},
+	{"turbostream_feed_gaps_total", "counter", "Unrecoverable holes in the stream after reconnects.",
+		always(func(f feedExport) float64 { return float64(f.GapsTotal) })},
+	{"turbostream_feed_gap_messages_total", "counter", "Messages lost inside stream gaps, when sequence numbers are known.",
+		always(func(f feedExport) float64 { return float64(f.GapMessagesTotal) })},
+	{"turbostream_feed_gap_seconds_total", "counter", "Time covered by stream gaps.",
+		always(func(f feedExport) float64 { return f.GapSecondsTotal })},
+	{"turbostream_feed_messages_per_second", "gauge", "Message rate over the last 10 seconds.",
+		always(func(f feedExport) float64 { return f.MessagesPerSecond10s })},
+	{"turbostream_feed_bytes_per_second", "gauge", "Payload byte rate over the last 10 seconds.",
+		always(func(f feedExport) float64 { return f.BytesPerSecond10s })},
+	{"turbostream_feed_last_message_timestamp_seconds", "gauge", "Unix time of the last message; alert on time() minus this for staleness.",
+		func(f feedExport) (float64, bool) {
+			return float64(f.LastMessage.UnixNano()) / 1e9, !f.LastMessage.IsZero()
+		}},
+	{"turbostream_feed_last_message_age_seconds", "gauge", "Seconds since the last message.",
+		func(f feedExport) (float64, bool) { return f.LastMessageAgeSeconds, !f.LastMessage.IsZero() }},
+	{"turbostream_feed_connected", "gauge", "1 while the feed's connection is up.",
+		always(func(f feedExport) float64 { return boolValue(f.WSConnected) })},
+	{"turbostream_feed_uptime_seconds", "gauge", "Seconds since the feed's connection last changed state.",
+		always(func(f feedExport) float64 { return f.CurrentUptimeSeconds })},
+	{"turbostream_feed_ping_rtt_seconds", "gauge", "Last heartbeat round trip.",
+		func(f feedExport) (float64, bool) { return f.PingRTTMs / 1000, f.LastPongAgeSeconds >= 0 }},
+	{"turbostream_feed_cache_items", "gauge", "Events held for the LLM context.",
+		always(func(f feedExport) float64 { return float64(f.CacheItemsCurrent) })},
+	{"turbostream_feed_cache_bytes", "gauge", "Approximate bytes of the events held for the LLM context.",
+		always(func(f feedExport) float64 { return float64(f.CacheApproxBytes) })},
+	{"turbostream_feed_cache_oldest_age_seconds", "gauge", "Age of the oldest event held for the LLM context.",
+		always(func(f feedExport) float64 { return f.OldestItemAgeSeconds })},
+	{"turbostream_llm_requests_total", "counter", "LLM requests for the feed, including errors and cancellations.",
+		always(func(f feedExport) float64 { return float64(f.LLMRequestsTotal) })},
+	{"turbostream_llm_errors_total", "counter", "LLM requests that failed.",
+		always(func(f feedExport) float64 { return float64(f.LLMErrorsTotal) })},
+	{"turbostream_llm_cancelled_total", "counter", "LLM requests cancelled by the user.",
+		always(func(f feedExport) float64 { return float64(f.LLMCancelledTotal) })},
+	{"turbostream_llm_input_tokens_total", "counter", "Prompt tokens sent to the LLM.",
+		always(func(f feedExport) float64 { return float64(f.InputTokensTotal) })},
+	{"turbostream_llm_output_tokens_total", "counter", "Tokens generated by the LLM.",
+		always(func(f feedExport) float64 { return float64(f.OutputTokensTotal) })},
+	{"turbostream_llm_cached_tokens_total", "counter", "Prompt tokens served from the provider's prompt cache.",
+		always(func(f feedExport) float64 { return float64(f.CachedTokensTotal) })},
+	{"turbostream_llm_estimated_requests_total", "counter", "LLM requests whose token counts were estimated locally.",
+		always(func(f feedExport) float64 { return float64(f.EstimatedRequestsTotal) })},
+	{"turbostream_llm_events_in_context", "gauge", "Feed events in the last LLM prompt.",
+		always(func(f feedExport) float64 { return float64(f.EventsInContextCurrent) })},
+	{"turbostream_llm_context_utilization_ratio", "gauge", "Share of the model's context window used by the last prompt.",
+		always(func(f feedExport) float64 { return f.ContextUtilizationPercent / 100 })},
+}
+
+// promConnMetrics are the families exposed per connection. Wire bytes can't
+// be split between the feeds sharing a socket, so they have no feed label.
+var promConnMetrics = []struct {
+	name  string
+	help  string
+	value func(c ConnectionBytes) uint64
+}{
+	{"turbostream_connection_wire_bytes_total", "Bytes read off the network on the connection.",
+		func(c ConnectionBytes) uint64 { return c.WireBytesTotal }},
+	{"turbostream_connection_decoded_bytes_total", "Bytes of the connection's frames after decompression.",
+		func(c ConnectionBytes) uint64 { return c.DecodedBytesTotal }},
+}
+
+// promHistograms are the histogram families exposed per feed.
+var promHistograms = []struct {
+	name string
+	help string
+	get  func(f feedExport) histogramSnapshot
+}{
+	{"turbostream_feed_payload_size_bytes", "Size of each message payload.",
+		func(f feedExport) histogramSnapshot { return f.Payload }},
+	{"turbostream_llm_ttft_seconds", "Time from an LLM request to its first token.",
+		func(f feedExport) histogramSnapshot { return f.TTFT }},
+	{"turbostream_llm_generation_seconds", "Time from an LLM request to its last token.",
+		func(f feedExport) histogramSnapshot { return f.GenTime }},
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writePrometheus writes the feeds and connections in the Prometheus text
+// exposition format.
+func writePrometheus(w *bufio.Writer, feeds []feedExport, conns []ConnectionBytes) {
+	fmt.Fprintf(w, "# HELP turbostream_feeds Feeds known to the TUI.\n# TYPE turbostream_feeds gauge\nturbostream_feeds %d\n", len(feeds))
+
+	for _, metric := range promMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.typ)
+		for _, f := range feeds {
+			if v, ok := metric.value(f); ok {
+				fmt.Fprintf(w, "%s{%s} %s\n", metric.name, feedLabels(f), formatPromValue(v))
+			}
+		}
+	}
+	for _, metric := range promConnMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name)
+		for _, c := range conns {
+			fmt.Fprintf(w, "%s{connection=\"%s\"} %d\n", metric.name, escapeLabel(c.Name), metric.value(c))
+		}
+	}
+	for _, hist := range promHistograms {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", hist.name, hist.help, hist.name)
+		for _, f := range feeds {
+			h := hist.get(f)
+			if len(h.Cumulative) == 0 {
+				continue
+			}
+			labels := feedLabels(f)
+			for i, bound := range h.Bounds {
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", hist.name, labels, formatPromValue(bound), h.Cumulative[i])
+			}
+			count := h.Cumulative[len(h.Cumulative)-1]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", hist.name, labels, count)
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", hist.name, labels, formatPromValue(h.Sum))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", hist.name, labels, count)
+		}
+	}
+}
+
+func feedLabels(f feedExport) string {
+	return fmt.Sprintf(`feed_id="%s",feed_name="%s"`, escapeLabel(f.FeedID), escapeLabel(f.Name))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatPromValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsExporter serves the collector's metrics on /metrics for Prometheus.
+type metricsExporter struct {
+	server *http.Server
+}
+
+// startMetricsExporter listens on addr right away, so a taken port is
+// reported at startup, and serves in the background.
+func startMetricsExporter(addr string, mc *MetricsCollector) (*metricsExporter, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf := bufio.NewWriter(w)
+		writePrometheus(buf, mc.Export(), mc.Connections())
+		buf.Flush()
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "TurboStream TUI metrics are at /metrics")
+	})
+	e := &metricsExporter{server: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}}
+	go e.server.Serve(ln)
+	return e, nil
+}
+
+func (e *metricsExporter) Close() error {
+	if e == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`say "hi"`, `say \"hi\"`},
+		{`C:\feeds`, `C:\\feeds`},
+		{"two\nlines", `two\nlines`},
+		{`\"` + "\n", `\\\"\n`},
+		{"tab\tand ünïcode", "tab\tand ünïcode"}, // only \, " and newline are escaped
+	}
+	for _, tt := range tests {
+		if got := escapeLabel(tt.in); got != tt.want {
+			t.Errorf("escapeLabel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPromValue(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{65536, "65536"},
+		{1.5e-7, "1.5e-07"},
+		{1e21, "1e+21"},
+	}
+	for _, tt := range tests {
+		if got := formatPromValue(tt.in); got != tt.want {
+			t.Errorf("formatPromValue(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// promLine is a sample line of the text exposition format.
+var promLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*")*\})? \S+$`)
+
+func TestWritePrometheus(t *testing.T) {
+	feeds := []feedExport{
+		{
+			FeedMetrics: FeedMetrics{FeedID: "feed-1", Name: `Trades "EU"` + "\n" + `C:\x`, MessagesReceivedTotal: 7, MessagesPerSecond10s: 0.5, LastPongAgeSeconds: -1},
+			LastMessage: time.Unix(1_700_000_000, 500_000_000),
+			Payload:     histogramSnapshot{Bounds: []float64{1024, 65536}, Cumulative: []uint64{2, 5, 7}, Sum: 100000},
+		},
+		{FeedMetrics: FeedMetrics{FeedID: "local:1", Name: "quiet", LastPongAgeSeconds: -1}},
+	}
+	conns := []ConnectionBytes{{Name: "backend", WireBytesTotal: 300, DecodedBytesTotal: 900}}
+
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	writePrometheus(w, feeds, conns)
+	w.Flush()
+	text := out.String()
+
+	labels := `feed_id="feed-1",feed_name="Trades \"EU\"\nC:\\x"`
+	for _, want := range []string{
+		"# HELP turbostream_feeds Feeds known to the TUI.\n# TYPE turbostream_feeds gauge\nturbostream_feeds 2\n",
+		"# TYPE turbostream_feed_messages_received_total counter\n",
+		"turbostream_feed_messages_received_total{" + labels + "} 7\n",
+		`turbostream_feed_messages_received_total{feed_id="local:1",feed_name="quiet"} 0` + "\n",
+		"turbostream_feed_messages_per_second{" + labels + "} 0.5\n",
+		"turbostream_feed_last_message_timestamp_seconds{" + labels + "} 1.7000000005e+09\n",
+		`turbostream_connection_wire_bytes_total{connection="backend"} 300` + "\n",
+		`turbostream_connection_decoded_bytes_total{connection="backend"} 900` + "\n",
+		"# TYPE turbostream_feed_payload_size_bytes histogram\n" +
+			"turbostream_feed_payload_size_bytes_bucket{" + labels + `,le="1024"} 2` + "\n" +
+			"turbostream_feed_payload_size_bytes_bucket{" + labels + `,le="65536"} 5` + "\n" +
+			"turbostream_feed_payload_size_bytes_bucket{" + labels + `,le="+Inf"} 7` + "\n" +
+			"turbostream_feed_payload_size_bytes_sum{" + labels + "} 100000\n" +
+			"turbostream_feed_payload_size_bytes_count{" + labels + "} 7\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("output lacks\n%s", want)
+		}
+	}
+	for _, absent := range []string{
+		`turbostream_feed_last_message_timestamp_seconds{feed_id="local:1"`, // no message yet
+		`turbostream_feed_ping_rtt_seconds{`,                                // no pong yet
+		`turbostream_feed_payload_size_bytes_bucket{feed_id="local:1"`,      // empty histogram
+		`turbostream_llm_ttft_seconds_bucket{`,
+	} {
+		if strings.Contains(text, absent) {
+			t.Errorf("output has %s", absent)
+		}
+	}
+
+	// Every family is described once before its samples, and every sample parses
+	described := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, typ, _ := strings.Cut(rest, " ")
+			if _, dup := described[name]; dup {
+				t.Errorf("family %s described twice", name)
+			}
+			described[name] = typ
+			continue
+		}
+		if !promLine.MatchString(line) {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+		name := line[:strings.IndexAny(line, "{ ")]
+		if _, ok := described[name]; ok {
+			continue
+		}
+		// Histogram samples carry a suffix on the family name
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			family = strings.TrimSuffix(family, suffix)
+		}
+		if described[family] != "histogram" {
+			t.Errorf("sample %s before its # TYPE line", name)
+		}
+	}
+}
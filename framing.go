@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"nhooyr.io/websocket"
+)
+
+// framingConfig controls how envelopes are compressed and encoded on the socket.
+type framingConfig struct {
+	Compression websocket.CompressionMode // permessage-deflate negotiation
+	MessagePack bool                      // ask the backend for binary MessagePack envelopes
+}
+
+func defaultFramingConfig() framingConfig {
+	return framingConfig{
+		Compression: websocket.CompressionNoContextTakeover,
+		MessagePack: false,
+	}
+}
+
+func parseCompressionMode(s string) websocket.CompressionMode {
+	switch s {
+	case "off", "disabled":
+		return websocket.CompressionDisabled
+	case "context-takeover":
+		return websocket.CompressionContextTakeover
+	}
+	return websocket.CompressionNoContextTakeover
+}
+
+// countingConn counts the bytes read off the network, before the websocket
+// layer inflates permessage-deflate frames.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// httpClient returns the client used for the websocket handshake. It reuses
+// the shared transport (proxy, TLS) and wraps every connection so wire bytes
+// can be compared with decoded bytes.
+func (c *wsClient) httpClient() *http.Client {
+	return countingHTTPClient(c.transport, &c.wireBytes)
+}
+
+// countingHTTPClient builds an HTTP/1.1 client on base that adds every byte
+// read from the network to wireBytes. Local HTTP sources use it as well.
+func countingHTTPClient(base *http.Transport, wireBytes *atomic.Int64) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{Conn: conn, read: wireBytes}, nil
+	}
+	// The handshake must stay on HTTP/1.1 to be upgraded.
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if transport.TLSClientConfig != nil {
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// decodeFrame turns one websocket message into a JSON envelope. Text frames
+// are JSON already; binary frames carry the same envelope as MessagePack.
+func decodeFrame(typ websocket.MessageType, data []byte) (json.RawMessage, error) {
+	if typ == websocket.MessageText {
+		return json.RawMessage(data), nil
+	}
+	var env map[string]interface{}
+	if err := msgpack.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("msgpack envelope: %w", err)
+	}
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("msgpack envelope: %w", err)
+	}
+	return raw, nil
+}
+
+// frameSize is what the current envelope cost on the wire and after inflation.
+type frameSize struct {
+	Wire    int // bytes read from the network, approximate per message
+	Decoded int // bytes after permessage-deflate, before JSON/MessagePack decoding
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"nhooyr.io/websocket"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	pack := func(v interface{}) []byte {
+		t.Helper()
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		typ     websocket.MessageType
+		data    []byte
+		want    string // JSON, compared by value
+		wantErr bool
+	}{
+		{"text passes through", websocket.MessageText, []byte(`{"type":"ping"}`), `{"type":"ping"}`, false},
+		{"msgpack envelope", websocket.MessageBinary,
+			pack(map[string]interface{}{"type": "feed-data", "payload": map[string]interface{}{"feedId": "f1", "seq": 42}}),
+			`{"type":"feed-data","payload":{"feedId":"f1","seq":42}}`, false},
+		{"arrays, floats, bools and nil", websocket.MessageBinary,
+			pack(map[string]interface{}{"a": []interface{}{1, 2.5, true, nil, "x"}}),
+			`{"a":[1,2.5,true,null,"x"]}`, false},
+		{"negative and large integers", websocket.MessageBinary,
+			pack(map[string]interface{}{"n": int64(-7), "big": uint64(1) << 40}),
+			`{"n":-7,"big":1099511627776}`, false},
+		{"binary payload becomes base64", websocket.MessageBinary,
+			pack(map[string]interface{}{"data": []byte("hi")}),
+			`{"data":"aGk="}`, false},
+		{"not an envelope", websocket.MessageBinary, pack([]int{1, 2}), "", true},
+		{"truncated", websocket.MessageBinary, pack(map[string]interface{}{"type": "feed-data"})[:5], "", true},
+		{"empty", websocket.MessageBinary, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := decodeFrame(tt.typ, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeFrame error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("decodeFrame returned invalid JSON %s: %v", raw, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeFrame = %s, want %s", raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCompressionMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want websocket.CompressionMode
+	}{
+		{"off", websocket.CompressionDisabled},
+		{"disabled", websocket.CompressionDisabled},
+		{"context-takeover", websocket.CompressionContextTakeover},
+		{"", websocket.CompressionNoContextTakeover},
+		{"no-context-takeover", websocket.CompressionNoContextTakeover},
+		{"bogus", websocket.CompressionNoContextTakeover},
+	}
+	for _, tt := range tests {
+		if got := parseCompressionMode(tt.in); got != tt.want {
+			t.Errorf("parseCompressionMode(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
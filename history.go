@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The history store keeps per-feed metrics on disk so the dashboard can show
+// trends from before the TUI started. Each feed has one fixed-size file made
+// of round-robin tiers, like RRDtool: a sample is written to the bucket of
+// every tier at once, coarser tiers holding the mean of their samples, and a
+// bucket is reused once its tier wraps. Files never grow and need no compaction.
+
+// Series kept for every feed, in on-disk order.
+const (
+	seriesMsgRate = iota
+	seriesByteRate
+	seriesCacheBytes
+	seriesGenTime
+	seriesPayloadAvg
+	seriesPingRTT
+	historySeriesCount
+)
+
+type historyTier struct {
+	step  time.Duration
+	slots int
+}
+
+var historyTiers = []historyTier{
+	{time.Second, 3600},        // 1s for an hour
+	{time.Minute, 7 * 24 * 60}, // 1m for a week
+	{time.Hour, 30 * 24},       // 1h for a month
+}
+
+const (
+	historyMagic    = "TSHIST01"
+	historyHeader   = 16                           // magic, series count, reserved
+	historySlotSize = 8 + 8 + 8*historySeriesCount // bucket start, sample count, means
+	historyMaxAge   = 31 * 24 * time.Hour          // files untouched for longer are removed
+	historyInterval = time.Second                  // sampling period, the finest tier's step
+	historyFileMode = 0o600
+
+	dashboardTrendPoints = 40 // columns of the widest trend sparkline
+)
+
+// dashboardRanges are the time ranges the dashboard's trend sparklines cycle through.
+var dashboardRanges = []struct {
+	Label    string
+	Duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+// historyDirFromEnv is TURBOSTREAM_HISTORY_DIR, or history in the user config
+// directory. "off" disables the store.
+func historyDirFromEnv() string {
+	if dir := getenvDefault("TURBOSTREAM_HISTORY_DIR", ""); dir != "" {
+		if dir == "off" {
+			return ""
+		}
+		return dir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "turbostream", "history")
+}
+
+// historySlot is one bucket of a tier.
+type historySlot struct {
+	Start  int64 // unix seconds of the bucket start; 0 when never written
+	Count  int64 // samples averaged into Values
+	Values [historySeriesCount]float64
+}
+
+func (s *historySlot) encode(b []byte) {
+	binary.LittleEndian.PutUint64(b[0:], uint64(s.Start))
+	binary.LittleEndian.PutUint64(b[8:], uint64(s.Count))
+	for i, v := range s.Values {
+		binary.LittleEndian.PutUint64(b[16+8*i:], math.Float64bits(v))
+	}
+}
+
+func (s *historySlot) decode(b []byte) {
+	s.Start = int64(binary.LittleEndian.Uint64(b[0:]))
+	s.Count = int64(binary.LittleEndian.Uint64(b[8:]))
+	for i := range s.Values {
+		s.Values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[16+8*i:]))
+	}
+}
+
+// historyFile is the on-disk history of one feed.
+type historyFile struct {
+	f       *os.File
+	current []historySlot // the bucket being filled, per tier
+}
+
+func historyFileSize() int64 {
+	size := int64(historyHeader)
+	for _, t := range historyTiers {
+		size += int64(t.slots) * historySlotSize
+	}
+	return size
+}
+
+// tierOffset is where tier's first slot starts in the file.
+func tierOffset(tier int) int64 {
+	off := int64(historyHeader)
+	for _, t := range historyTiers[:tier] {
+		off += int64(t.slots) * historySlotSize
+	}
+	return off
+}
+
+// errHistoryLocked is returned for a file another running TUI is writing.
+var errHistoryLocked = errors.New("in use by another turbostream")
+
+func openHistoryFile(path string) (*historyFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, historyFileMode)
+	if err != nil {
+		return nil, err
+	}
+	// Before the header check, which may truncate the file
+	if err := lockHistoryFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	header := make([]byte, historyHeader)
+	_, err = f.ReadAt(header, 0)
+	info, statErr := f.Stat()
+	if err != nil || statErr != nil || string(header[:8]) != historyMagic ||
+		binary.LittleEndian.Uint32(header[8:]) != historySeriesCount || info.Size() != historyFileSize() {
+		// New, or written with another layout: start over
+		if err := initHistoryFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &historyFile{f: f, current: make([]historySlot, len(historyTiers))}, nil
+}
+
+func initHistoryFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if err := f.Truncate(historyFileSize()); err != nil {
+		return err
+	}
+	header := make([]byte, historyHeader)
+	copy(header, historyMagic)
+	binary.LittleEndian.PutUint32(header[8:], historySeriesCount)
+	_, err := f.WriteAt(header, 0)
+	return err
+}
+
+// add folds a sample into the current bucket of every tier and writes them.
+func (h *historyFile) add(at time.Time, values [historySeriesCount]float64) error {
+	buf := make([]byte, historySlotSize)
+	for tier, t := range historyTiers {
+		step := int64(t.step / time.Second)
+		start := at.Unix() / step * step
+		slot := &h.current[tier]
+		off := tierOffset(tier) + (start/step%int64(t.slots))*historySlotSize
+
+		if slot.Start != start {
+			// Continue a bucket written before a restart instead of overwriting it
+			*slot = historySlot{Start: start}
+			if _, err := h.f.ReadAt(buf, off); err == nil {
+				var onDisk historySlot
+				onDisk.decode(buf)
+				if onDisk.Start == start {
+					*slot = onDisk
+				}
+			}
+		}
+		n := float64(slot.Count)
+		for i, v := range values {
+			slot.Values[i] = (slot.Values[i]*n + v) / (n + 1)
+		}
+		slot.Count++
+
+		slot.encode(buf)
+		if _, err := h.f.WriteAt(buf, off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the slots of tier holding buckets [first, first+count).
+// Slots that hold an older wrap of the ring are returned as is; callers
+// check Start.
+func (h *historyFile) read(tier int, first int64, count int) ([]historySlot, error) {
+	t := historyTiers[tier]
+	if count > t.slots {
+		count = t.slots
+	}
+	step := int64(t.step / time.Second)
+	buf := make([]byte, count*historySlotSize)
+	idx := int(first / step % int64(t.slots))
+
+	// The range wraps around the ring at most once
+	head := count
+	if idx+count > t.slots {
+		head = t.slots - idx
+	}
+	if _, err := h.f.ReadAt(buf[:head*historySlotSize], tierOffset(tier)+int64(idx)*historySlotSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if head < count {
+		if _, err := h.f.ReadAt(buf[head*historySlotSize:], tierOffset(tier)); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+
+	slots := make([]historySlot, count)
+	for i := range slots {
+		slots[i].decode(buf[i*historySlotSize:])
+	}
+	return slots, nil
+}
+
+// historyStore samples the collector every second into the feeds' files.
+type historyStore struct {
+	dir string
+
+	mu      sync.Mutex
+	backend string                  // URL of the backend the feed IDs belong to
+	files   map[string]*historyFile // by file key; nil when locked by another TUI
+	err     error                   // last write error, reported once
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openHistoryStore creates dir if needed and removes files of feeds that
+// haven't been seen for longer than the coarsest tier keeps. Feeds are those
+// of the backend at backendURL.
+func openHistoryStore(dir, backendURL string) (*historyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && strings.HasSuffix(e.Name(), ".tsdb") &&
+			time.Since(info.ModTime()) > historyMaxAge {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+	return &historyStore{dir: dir, backend: backendURL, files: make(map[string]*historyFile)}, nil
+}
+
+// SetBackend switches the store to the feeds of another backend.
+func (s *historyStore) SetBackend(backendURL string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backend = backendURL
+}
+
+var safeFileKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// historyKey names a feed's file. Feed IDs are only unique within a
+// backend, so they are prefixed with a hash of its URL. Local feeds get new
+// IDs every run, so their history follows the feed name instead.
+func historyKey(backendURL, feedID, name string) string {
+	hash := func(s string) string {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		return fmt.Sprintf("%016x", h.Sum64())
+	}
+	if isLocalFeed(feedID) {
+		return "local-" + hash(name)
+	}
+	backend := hash(strings.TrimRight(backendURL, "/"))
+	if safeFileKey.MatchString(feedID) {
+		return backend + "-" + feedID
+	}
+	return backend + "-feed-" + hash(feedID)
+}
+
+// fileLocked opens a feed's file on first use. A file held by another TUI
+// is left to it for the rest of the session: the first call returns the
+// error, later ones a nil file. Caller must hold s.mu.
+func (s *historyStore) fileLocked(key string) (*historyFile, error) {
+	if hf, ok := s.files[key]; ok {
+		return hf, nil
+	}
+	hf, err := openHistoryFile(filepath.Join(s.dir, key+".tsdb"))
+	if errors.Is(err, errHistoryLocked) {
+		s.files[key] = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.files[key] = hf
+	return hf, nil
+}
+
+// Start samples mc every second until Close.
+func (s *historyStore) Start(mc *MetricsCollector) {
+	if s == nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(historyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.Record(now, mc.Export())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Record writes one sample of every feed.
+func (s *historyStore) Record(now time.Time, feeds []feedExport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range feeds {
+		hf, err := s.fileLocked(historyKey(s.backend, f.FeedID, f.Name))
+		if err == nil && hf != nil {
+			err = hf.add(now, historyValues(f.FeedMetrics))
+		}
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+}
+
+func historyValues(fm FeedMetrics) [historySeriesCount]float64 {
+	var v [historySeriesCount]float64
+	v[seriesMsgRate] = fm.MessagesPerSecond10s
+	v[seriesByteRate] = fm.BytesPerSecond10s
+	v[seriesCacheBytes] = float64(fm.CacheApproxBytes)
+	v[seriesGenTime] = fm.GenerationTimeMs
+	v[seriesPayloadAvg] = fm.PayloadSizeAvgBytes
+	v[seriesPingRTT] = fm.PingRTTMs
+	return v
+}
+
+// Err returns the first write error since the last call.
+func (s *historyStore) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// Range returns every series of a feed over the span ending at now, as
+// points columns of equal width. A column is the mean of the samples that
+// fall in it, or NaN when there are none. The coarsest tier that still
+// gives each column at least one bucket is read.
+func (s *historyStore) Range(feedID, name string, span time.Duration, points int, now time.Time) ([historySeriesCount][]float64, error) {
+	var out [historySeriesCount][]float64
+	if points < 1 {
+		return out, nil
+	}
+	tier := 0
+	for i, t := range historyTiers {
+		if t.step <= span/time.Duration(points) && t.step*time.Duration(t.slots) >= span {
+			tier = i
+		}
+	}
+	step := int64(historyTiers[tier].step / time.Second)
+	from := now.Add(-span).Unix()
+	first := from / step * step
+	count := int((now.Unix()-first)/step) + 1
+
+	s.mu.Lock()
+	hf, err := s.fileLocked(historyKey(s.backend, feedID, name))
+	var slots []historySlot
+	if err == nil && hf == nil {
+		err = errHistoryLocked
+	}
+	if err == nil {
+		slots, err = hf.read(tier, first, count)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return out, err
+	}
+
+	var sums [historySeriesCount][]float64
+	weights := make([]float64, points)
+	for i := range out {
+		out[i] = make([]float64, points)
+		sums[i] = make([]float64, points)
+	}
+	spanSeconds := float64(now.Unix() - from)
+	for i, slot := range slots {
+		start := first + int64(i)*step
+		if slot.Start != start || slot.Count == 0 {
+			continue // never written, or left from an older wrap of the ring
+		}
+		col := int(float64(start-from) / spanSeconds * float64(points))
+		if col < 0 {
+			col = 0
+		}
+		if col >= points {
+			col = points - 1
+		}
+		n := float64(slot.Count)
+		for j, v := range slot.Values {
+			sums[j][col] += v * n
+		}
+		weights[col] += n
+	}
+	for j := range out {
+		for col := range out[j] {
+			if weights[col] == 0 {
+				out[j][col] = math.NaN()
+			} else {
+				out[j][col] = sums[j][col] / weights[col]
+			}
+		}
+	}
+	return out, nil
+}
+
+// Close stops sampling and closes the files.
+func (s *historyStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for key, hf := range s.files {
+		if hf == nil {
+			delete(s.files, key)
+			continue
+		}
+		if err := hf.f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, key)
+	}
+	return firstErr
+}
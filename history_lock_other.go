@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockHistoryFile does nothing where flock isn't available; two TUIs
+// watching the same feed will share its buckets there.
+func lockHistoryFile(f *os.File) error {
+	return nil
+}
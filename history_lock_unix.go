@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockHistoryFile takes an exclusive lock on f until it is closed, so two
+// running TUIs don't average their samples into the same buckets.
+func lockHistoryFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errHistoryLocked
+	}
+	return err
+}
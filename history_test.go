@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       [3]string // backend URL, feed ID, feed name
+		wantShared bool
+	}{
+		{"same feed on two backends", [3]string{"https://a.example", "feed-1", "Trades"}, [3]string{"https://b.example", "feed-1", "Trades"}, false},
+		{"trailing slash", [3]string{"https://a.example/", "feed-1", "Trades"}, [3]string{"https://a.example", "feed-1", "Trades"}, true},
+		{"two feeds on one backend", [3]string{"https://a.example", "feed-1", "Trades"}, [3]string{"https://a.example", "feed-2", "Trades"}, false},
+		{"local feed renumbered", [3]string{"https://a.example", "local:1", "sensors"}, [3]string{"https://b.example", "local:7", "sensors"}, true},
+		{"two local feeds", [3]string{"", "local:1", "sensors"}, [3]string{"", "local:1", "trades"}, false},
+		{"unsafe feed ID", [3]string{"https://a.example", "../feed 1", "x"}, [3]string{"https://b.example", "../feed 1", "x"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := historyKey(tt.a[0], tt.a[1], tt.a[2])
+			b := historyKey(tt.b[0], tt.b[1], tt.b[2])
+			if (a == b) != tt.wantShared {
+				t.Errorf("keys %q and %q: shared = %v, want %v", a, b, a == b, tt.wantShared)
+			}
+			for _, key := range []string{a, b} {
+				if !safeFileKey.MatchString(key) {
+					t.Errorf("key %q is not a safe file name", key)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryStoreRecordAndRange(t *testing.T) {
+	s, err := openHistoryStore(t.TempDir(), "https://a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	feed := feedExport{FeedMetrics: FeedMetrics{FeedID: "feed-1", Name: "Trades", MessagesPerSecond10s: 4}}
+	s.Record(now.Add(-2*time.Second), []feedExport{feed})
+	feed.MessagesPerSecond10s = 8
+	s.Record(now, []feedExport{feed})
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := s.Range("feed-1", "Trades", 5*time.Minute, 10, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rate := series[seriesMsgRate]
+	if got := rate[len(rate)-1]; got != 6 {
+		t.Errorf("last column = %v, want the mean 6", got)
+	}
+	if !math.IsNaN(rate[0]) {
+		t.Errorf("first column = %v, want NaN for no samples", rate[0])
+	}
+
+	// The same feed ID on another backend starts empty
+	s.SetBackend("https://b.example")
+	series, err = s.Range("feed-1", "Trades", 5*time.Minute, 10, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series[seriesMsgRate][9]; !math.IsNaN(got) {
+		t.Errorf("other backend's column = %v, want NaN", got)
+	}
+}
+
+func TestHistoryStoreLockedByAnotherProcess(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("history files are not locked on " + runtime.GOOS)
+	}
+	dir := t.TempDir()
+	first, err := openHistoryStore(dir, "https://a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := openHistoryStore(dir, "https://a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	now := time.Now()
+	feeds := []feedExport{{FeedMetrics: FeedMetrics{FeedID: "feed-1", Name: "Trades"}}}
+	first.Record(now, feeds)
+	if err := first.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Record(now, feeds)
+	if err := second.Err(); !errors.Is(err, errHistoryLocked) || !strings.Contains(err.Error(), ".tsdb") {
+		t.Fatalf("second store's Err() = %v, want the file reported as locked", err)
+	}
+	second.Record(now.Add(time.Second), feeds)
+	if err := second.Err(); err != nil {
+		t.Errorf("locked file reported again: %v", err)
+	}
+	if _, err := second.Range("feed-1", "Trades", time.Minute, 10, now); !errors.Is(err, errHistoryLocked) {
+		t.Errorf("Range on a locked file = %v, want errHistoryLocked", err)
+	}
+}
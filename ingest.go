@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// dropPolicy decides which event is discarded when a feed's ring buffer is full.
+type dropPolicy int
+
+const (
+	dropOldest dropPolicy = iota // keep the freshest data (default)
+	dropNewest                   // keep what is already queued, reject new arrivals
+)
+
+func parseDropPolicy(s string) dropPolicy {
+	if s == "newest" {
+		return dropNewest
+	}
+	return dropOldest
+}
+
+// ingestConfig controls the ingestion pipeline between the socket and the UI.
+type ingestConfig struct {
+	BufferSize    int           // per-feed ring buffer capacity
+	FrameInterval time.Duration // how often batches are handed to the UI
+	DropPolicy    dropPolicy
+}
+
+func defaultIngestConfig() ingestConfig {
+	return ingestConfig{
+		BufferSize:    1024,
+		FrameInterval: 100 * time.Millisecond,
+		DropPolicy:    dropOldest,
+	}
+}
+
+// feedBatchMsg carries all feed-data received since the previous frame.
+type feedBatchMsg struct {
+	Feeds map[string][]feedDataMsg // feedID -> events in arrival order
+}
+
+// feedRing is a fixed-size FIFO of pending events for one feed.
+type feedRing struct {
+	items []feedDataMsg
+	head  int
+	size  int
+}
+
+func newFeedRing(capacity int) *feedRing {
+	return &feedRing{items: make([]feedDataMsg, capacity)}
+}
+
+// push appends msg and reports whether an event had to be dropped.
+func (r *feedRing) push(msg feedDataMsg, policy dropPolicy) bool {
+	if r.size == len(r.items) {
+		if policy == dropNewest {
+			return true
+		}
+		r.items[r.head] = msg
+		r.head = (r.head + 1) % len(r.items)
+		return true
+	}
+	r.items[(r.head+r.size)%len(r.items)] = msg
+	r.size++
+	return false
+}
+
+func (r *feedRing) drain() []feedDataMsg {
+	out := make([]feedDataMsg, r.size)
+	for i := 0; i < r.size; i++ {
+		out[i] = r.items[(r.head+i)%len(r.items)]
+		r.items[(r.head+i)%len(r.items)] = feedDataMsg{}
+	}
+	r.head, r.size = 0, 0
+	return out
+}
+
+// ingestor decouples the socket read loop from the Bubble Tea update loop.
+// Push never blocks: events land in per-feed ring buffers, metrics are updated
+// immediately, and a flusher hands coalesced batches to the UI once per frame.
+type ingestor struct {
+	cfg     ingestConfig
+	metrics *MetricsCollector
+
+	mu      sync.Mutex
+	rings   map[string]*feedRing
+	pending int
+
+	batches chan feedBatchMsg
+	done    chan struct{}
+	start   sync.Once
+	stop    sync.Once
+}
+
+func newIngestor(cfg ingestConfig, metrics *MetricsCollector) *ingestor {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultIngestConfig().BufferSize
+	}
+	if cfg.FrameInterval <= 0 {
+		cfg.FrameInterval = defaultIngestConfig().FrameInterval
+	}
+	in := &ingestor{
+		cfg:     cfg,
+		metrics: metrics,
+		rings:   make(map[string]*feedRing),
+		batches: make(chan feedBatchMsg, 1),
+		done:    make(chan struct{}),
+	}
+	return in
+}
+
+// Push queues a feed-data event for the next frame.
+func (in *ingestor) Push(msg feedDataMsg) {
+	in.metrics.InitFeed(msg.FeedID, msg.FeedName)
+	in.metrics.RecordMessage(msg.FeedID, len(msg.Data))
+	in.metrics.RecordWSStatus(msg.FeedID, true)
+
+	in.mu.Lock()
+	ring, ok := in.rings[msg.FeedID]
+	if !ok {
+		ring = newFeedRing(in.cfg.BufferSize)
+		in.rings[msg.FeedID] = ring
+	}
+	dropped := ring.push(msg, in.cfg.DropPolicy)
+	if !dropped {
+		in.pending++
+	}
+	in.mu.Unlock()
+
+	if dropped {
+		in.metrics.RecordPacketLoss(msg.FeedID, "ingest_overflow")
+	}
+}
+
+func (in *ingestor) flushLoop() {
+	ticker := time.NewTicker(in.cfg.FrameInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-in.done:
+			return
+		case <-ticker.C:
+		}
+
+		// The UI hasn't consumed the previous batch yet; keep buffering.
+		if len(in.batches) > 0 {
+			continue
+		}
+
+		in.mu.Lock()
+		if in.pending == 0 {
+			in.mu.Unlock()
+			continue
+		}
+		batch := feedBatchMsg{Feeds: make(map[string][]feedDataMsg, len(in.rings))}
+		for feedID, ring := range in.rings {
+			if ring.size > 0 {
+				batch.Feeds[feedID] = ring.drain()
+			}
+		}
+		in.pending = 0
+		in.mu.Unlock()
+
+		in.batches <- batch
+	}
+}
+
+// ListenCmd waits for the next batch of feed data. The flusher starts with the
+// first listener so an unused ingestor holds no goroutine.
+func (in *ingestor) ListenCmd() tea.Cmd {
+	in.start.Do(func() { go in.flushLoop() })
+	return func() tea.Msg {
+		select {
+		case batch := <-in.batches:
+			return batch
+		case <-in.done:
+			return nil
+		}
+	}
+}
+
+// Backlog is the number of events waiting for the next frame.
+func (in *ingestor) Backlog() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.pending
+}
+
+// Reset drops buffered events, including a batch the UI hasn't taken yet.
+func (in *ingestor) Reset() {
+	in.mu.Lock()
+	in.rings = make(map[string]*feedRing)
+	in.pending = 0
+	in.mu.Unlock()
+	select {
+	case <-in.batches:
+	default:
+	}
+}
+
+func (in *ingestor) Close() {
+	in.stop.Do(func() { close(in.done) })
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFeedRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		pushes   int
+		policy   dropPolicy
+		dropped  int
+		want     []string // Data of the drained events
+	}{
+		{"under capacity", 3, 2, dropOldest, 0, []string{"0", "1"}},
+		{"exactly full", 3, 3, dropOldest, 0, []string{"0", "1", "2"}},
+		{"drop oldest", 3, 5, dropOldest, 2, []string{"2", "3", "4"}},
+		{"drop newest", 3, 5, dropNewest, 2, []string{"0", "1", "2"}},
+		{"drop oldest wraps twice", 2, 7, dropOldest, 5, []string{"5", "6"}},
+		{"single slot", 1, 3, dropOldest, 2, []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFeedRing(tt.capacity)
+			dropped := 0
+			for i := 0; i < tt.pushes; i++ {
+				if r.push(feedDataMsg{Data: fmt.Sprint(i)}, tt.policy) {
+					dropped++
+				}
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.dropped)
+			}
+			got := r.drain()
+			if len(got) != len(tt.want) {
+				t.Fatalf("drained %d events, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if e.Data != tt.want[i] {
+					t.Errorf("event %d = %q, want %q", i, e.Data, tt.want[i])
+				}
+			}
+			if again := r.drain(); len(again) != 0 {
+				t.Errorf("second drain returned %d events", len(again))
+			}
+		})
+	}
+}
+
+func TestFeedRingReusedAfterDrain(t *testing.T) {
+	r := newFeedRing(2)
+	r.push(feedDataMsg{Data: "a"}, dropOldest)
+	r.push(feedDataMsg{Data: "b"}, dropOldest)
+	r.push(feedDataMsg{Data: "c"}, dropOldest) // head moves off slot 0
+	r.drain()
+	r.push(feedDataMsg{Data: "d"}, dropOldest)
+	got := r.drain()
+	if len(got) != 1 || got[0].Data != "d" {
+		t.Fatalf("drain after reuse = %+v, want [d]", got)
+	}
+}
+
+func TestParseDropPolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want dropPolicy
+	}{
+		{"newest", dropNewest},
+		{"oldest", dropOldest},
+		{"", dropOldest},
+		{"bogus", dropOldest},
+	}
+	for _, tt := range tests {
+		if got := parseDropPolicy(tt.in); got != tt.want {
+			t.Errorf("parseDropPolicy(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIngestorPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  dropPolicy
+		pushes  int
+		backlog int
+		dropped uint64
+	}{
+		{"fits", dropOldest, 3, 3, 0},
+		{"overflow drops oldest", dropOldest, 6, 4, 2},
+		{"overflow drops newest", dropNewest, 6, 4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := NewMetricsCollector()
+			in := newIngestor(ingestConfig{BufferSize: 4, FrameInterval: time.Hour, DropPolicy: tt.policy}, mc)
+			defer in.Close()
+			for i := 0; i < tt.pushes; i++ {
+				in.Push(feedDataMsg{FeedID: "f1", FeedName: "feed", Data: "x"})
+			}
+			if got := in.Backlog(); got != tt.backlog {
+				t.Errorf("Backlog() = %d, want %d", got, tt.backlog)
+			}
+			fm := mc.GetMetrics().Feeds[0]
+			if fm.MessagesReceivedTotal != uint64(tt.pushes) {
+				t.Errorf("MessagesReceivedTotal = %d, want %d", fm.MessagesReceivedTotal, tt.pushes)
+			}
+			if fm.MessagesDroppedTotal != tt.dropped {
+				t.Errorf("MessagesDroppedTotal = %d, want %d", fm.MessagesDroppedTotal, tt.dropped)
+			}
+			in.Reset()
+			if got := in.Backlog(); got != 0 {
+				t.Errorf("Backlog() after Reset = %d", got)
+			}
+		})
+	}
+}
+
+func TestIngestorBatchesPerFeed(t *testing.T) {
+	in := newIngestor(ingestConfig{BufferSize: 8, FrameInterval: time.Millisecond}, NewMetricsCollector())
+	defer in.Close()
+	in.Push(feedDataMsg{FeedID: "a", Data: "1"})
+	in.Push(feedDataMsg{FeedID: "b", Data: "2"})
+	in.Push(feedDataMsg{FeedID: "a", Data: "3"})
+
+	batch, ok := in.ListenCmd()().(feedBatchMsg)
+	if !ok {
+		t.Fatal("ListenCmd did not return a feedBatchMsg")
+	}
+	if got := batch.Feeds["a"]; len(got) != 2 || got[0].Data != "1" || got[1].Data != "3" {
+		t.Errorf(`batch["a"] = %+v, want events 1 and 3 in order`, got)
+	}
+	if got := batch.Feeds["b"]; len(got) != 1 || got[0].Data != "2" {
+		t.Errorf(`batch["b"] = %+v, want event 2`, got)
+	}
+	if in.Backlog() != 0 {
+		t.Errorf("Backlog() = %d after the batch was taken", in.Backlog())
+	}
+}
@@ -0,0 +1,717 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+	"nhooyr.io/websocket"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// Local source kinds, in the order the Register Feed form cycles through them.
+const (
+	sourceWebSocket = "websocket"
+	sourceSSE       = "sse"
+	sourcePoll      = "poll"
+	sourceStdin     = "stdin"
+	sourceFile      = "file"
+	sourceTCP       = "tcp"
+	sourceUnix      = "unix"
+	sourceMQTT      = "mqtt"
+	sourceNATS      = "nats"
+)
+
+var sourceKinds = []string{sourceWebSocket, sourceSSE, sourcePoll, sourceStdin, sourceFile, sourceTCP, sourceUnix, sourceMQTT, sourceNATS}
+
+// localSourceConfig describes an upstream watched directly, without
+// registering a feed with the backend.
+type localSourceConfig struct {
+	Kind      string // one of sourceKinds; inferred from URL when empty
+	Name      string
+	URL       string        // ws(s) or http(s) URL, file path, host:port, socket path, or "-" for stdin
+	Messages  []string      // sent after every connect (websocket, tcp, unix), like a feed's connectionMessages
+	EventPath string        // JSONPath to the event name in each message, e.g. $.type or data.0.e
+	DataPath  string        // poll: JSONPath selecting the events in each response, e.g. $.items[*]
+	Interval  time.Duration // poll: time between requests
+	Topics    []string      // mqtt, nats: topic filters or subjects, wildcards allowed
+	Username  string        // mqtt, nats; taken from the URL's user info when empty
+	Password  string        // mqtt, nats; for NATS either one alone is a token
+}
+
+// localFeedPrefix marks the IDs of synthetic feeds so they are never sent to the backend.
+const localFeedPrefix = "local:"
+
+// localReadLimit allows the large snapshot messages some public feeds send.
+const localReadLimit = 4 << 20
+
+// defaultPollInterval applies when a poll source gives no interval.
+const defaultPollInterval = 5 * time.Second
+
+func isLocalFeed(feedID string) bool {
+	return strings.HasPrefix(feedID, localFeedPrefix)
+}
+
+// backendConnection names the backend socket, which carries every backend feed.
+const backendConnection = "backend"
+
+// feedConnection returns the connection a feed arrives on: a local source's
+// synthetic feed (topic feeds included) or the backend socket.
+func feedConnection(feedID string) string {
+	if !isLocalFeed(feedID) {
+		return backendConnection
+	}
+	id, _, _ := strings.Cut(feedID, "/")
+	return id
+}
+
+// sourceConfigError points at the setting that made a config invalid, so the
+// Register Feed form can mark the right input.
+type sourceConfigError struct {
+	Field string // "url", "eventPath", "dataPath", "interval" or "topics"
+	Err   error
+}
+
+func (e *sourceConfigError) Error() string { return e.Err.Error() }
+func (e *sourceConfigError) Unwrap() error { return e.Err }
+
+func invalidSource(field, format string, args ...interface{}) error {
+	return &sourceConfigError{Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+// inferSourceKind picks a kind from the URL: ws(s):// is a WebSocket, http(s)://
+// a Server-Sent Events stream, "-" stdin, tcp:// and unix:// sockets,
+// mqtt(s):// and nats:// or tls:// brokers, and anything else a file to follow.
+func inferSourceKind(rawURL string) string {
+	switch {
+	case rawURL == "-":
+		return sourceStdin
+	case strings.HasPrefix(rawURL, "ws://"), strings.HasPrefix(rawURL, "wss://"):
+		return sourceWebSocket
+	case strings.HasPrefix(rawURL, "http://"), strings.HasPrefix(rawURL, "https://"):
+		return sourceSSE
+	case strings.HasPrefix(rawURL, "tcp://"):
+		return sourceTCP
+	case strings.HasPrefix(rawURL, "unix://"):
+		return sourceUnix
+	case strings.HasPrefix(rawURL, "mqtt://"), strings.HasPrefix(rawURL, "mqtts://"):
+		return sourceMQTT
+	case strings.HasPrefix(rawURL, "nats://"), strings.HasPrefix(rawURL, "tls://"):
+		return sourceNATS
+	}
+	return sourceFile
+}
+
+// normalize fills defaults, strips scheme prefixes from addresses and checks
+// the settings the kind needs.
+func (cfg localSourceConfig) normalize() (localSourceConfig, error) {
+	cfg.URL = strings.TrimSpace(cfg.URL)
+	if cfg.Kind == "" {
+		cfg.Kind = inferSourceKind(cfg.URL)
+	}
+	switch cfg.Kind {
+	case sourceWebSocket:
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return cfg, invalidSource("url", "WebSocket source URL must be ws:// or wss://, got %q", cfg.URL)
+		}
+	case sourceSSE, sourcePoll:
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, invalidSource("url", "%s source URL must be http:// or https://, got %q", cfg.Kind, cfg.URL)
+		}
+	case sourceStdin:
+		cfg.URL = "-"
+	case sourceFile:
+		cfg.URL = strings.TrimPrefix(cfg.URL, "file://")
+		if cfg.URL == "" {
+			return cfg, invalidSource("url", "file source needs a path")
+		}
+	case sourceTCP:
+		cfg.URL = strings.TrimPrefix(cfg.URL, "tcp://")
+		if _, _, err := net.SplitHostPort(cfg.URL); err != nil {
+			return cfg, invalidSource("url", "tcp source needs host:port, got %q", cfg.URL)
+		}
+	case sourceUnix:
+		cfg.URL = strings.TrimPrefix(cfg.URL, "unix://")
+		if cfg.URL == "" {
+			return cfg, invalidSource("url", "unix source needs a socket path")
+		}
+	case sourceMQTT, sourceNATS:
+		var err error
+		if cfg, err = cfg.normalizeBroker(); err != nil {
+			return cfg, err
+		}
+	default:
+		return cfg, invalidSource("url", "unknown source type %q (available: %s)", cfg.Kind, strings.Join(sourceKinds, ", "))
+	}
+	if cfg.Kind == sourcePoll && cfg.Interval <= 0 {
+		cfg.Interval = defaultPollInterval
+	}
+	if _, err := parseJSONPath(cfg.EventPath); err != nil {
+		return cfg, invalidSource("eventPath", "event path: %v", err)
+	}
+	if _, err := parseJSONPath(cfg.DataPath); err != nil {
+		return cfg, invalidSource("dataPath", "data path: %v", err)
+	}
+	if cfg.Name == "" {
+		cfg.Name = defaultSourceName(cfg)
+	}
+	return cfg, nil
+}
+
+// brokerSchemes are the URL schemes of each broker kind and whether they use TLS.
+var brokerSchemes = map[string]map[string]bool{
+	sourceMQTT: {"mqtt": false, "mqtts": true},
+	sourceNATS: {"nats": false, "tls": true},
+}
+
+var brokerDefaultPorts = map[string]string{
+	"mqtt":  "1883",
+	"mqtts": "8883",
+	"nats":  "4222",
+	"tls":   "4222",
+}
+
+// normalizeBroker moves credentials out of a broker URL, so they are never
+// shown with the feed, adds the default port and checks the topics.
+func (cfg localSourceConfig) normalizeBroker() (localSourceConfig, error) {
+	schemes := brokerSchemes[cfg.Kind]
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return cfg, invalidSource("url", "%s source needs a broker URL such as %s://localhost, got %q", cfg.Kind, cfg.Kind, cfg.URL)
+	}
+	if _, ok := schemes[u.Scheme]; !ok {
+		names := make([]string, 0, len(schemes))
+		for scheme := range schemes {
+			names = append(names, scheme+"://")
+		}
+		sort.Strings(names)
+		return cfg, invalidSource("url", "%s source URL must be %s, got %q", cfg.Kind, strings.Join(names, " or "), cfg.URL)
+	}
+	if u.User != nil {
+		if cfg.Username == "" {
+			cfg.Username = u.User.Username()
+		}
+		if pass, ok := u.User.Password(); ok && cfg.Password == "" {
+			cfg.Password = pass
+		}
+		u.User = nil
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), brokerDefaultPorts[u.Scheme])
+	}
+	u.Path, u.RawQuery, u.Fragment = "", "", ""
+	cfg.URL = u.String()
+
+	validate := validateMQTTFilter
+	if cfg.Kind == sourceNATS {
+		validate = validateNATSSubject
+	}
+	var topics []string
+	for _, topic := range cfg.Topics {
+		if topic = strings.TrimSpace(topic); topic == "" {
+			continue
+		}
+		if err := validate(topic); err != nil {
+			return cfg, invalidSource("topics", "%v", err)
+		}
+		topics = append(topics, topic)
+	}
+	if len(topics) == 0 {
+		return cfg, invalidSource("topics", "%s source needs at least one topic", cfg.Kind)
+	}
+	cfg.Topics = topics
+	return cfg, nil
+}
+
+// splitTopics reads a comma- or space-separated topic list, as typed in the
+// Register Feed form.
+func splitTopics(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func defaultSourceName(cfg localSourceConfig) string {
+	switch cfg.Kind {
+	case sourceWebSocket, sourceSSE, sourcePoll, sourceMQTT, sourceNATS:
+		if u, err := url.Parse(cfg.URL); err == nil {
+			return u.Host
+		}
+	case sourceStdin:
+		return "stdin"
+	case sourceFile, sourceUnix:
+		return cfg.URL[strings.LastIndex(cfg.URL, "/")+1:]
+	}
+	return cfg.URL
+}
+
+// sourceMessage is one message read from an upstream.
+type sourceMessage struct {
+	Data    []byte
+	Event   string // event name given by the transport (the SSE event field), if any
+	Topic   string // concrete topic of a broker message; each topic is its own feed
+	Frame   frameSize
+	Dropped string // set instead of Data when the message could not be read
+}
+
+// sourceTransport reaches one kind of upstream. Run connects, calls connected
+// once data can flow, and delivers messages until the connection fails or
+// ctx ends. Returning errSourceEnded, or an error wrapped by sourceEnded,
+// stops the source for good (stdin at EOF, rejected credentials); any other
+// error is retried with the reconnect policy.
+type sourceTransport interface {
+	Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error
+}
+
+var errSourceEnded = errors.New("source ended")
+
+// endedError is a failure that retrying can't fix.
+type endedError struct{ err error }
+
+func (e endedError) Error() string        { return e.err.Error() }
+func (e endedError) Unwrap() error        { return e.err }
+func (e endedError) Is(target error) bool { return target == errSourceEnded }
+
+func sourceEnded(err error) error {
+	return endedError{err: err}
+}
+
+// localSource runs a transport and turns every message into feed-data for a
+// synthetic feed, so the stream view, metrics and dashboard work the same as
+// for backend feeds. Connection changes arrive in the UI as localStatusMsg.
+type localSource struct {
+	id  string
+	cfg localSourceConfig
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	incoming chan tea.Msg
+
+	policy    reconnectPolicy
+	transport sourceTransport
+	ingest    atomic.Pointer[ingestor] // swapped when a profile switch replaces the ingestor
+	recorder  *sessionRecorder
+
+	wireBytes atomic.Int64
+	seq       map[string]int64 // feed ID -> last sequence number; delivery goroutine only
+
+	mu     sync.Mutex
+	topics map[string]string // concrete broker topic -> feed ID
+}
+
+// newLocalSource builds a source for a normalized config; the reconnect,
+// heartbeat, transport, ingest and recorder settings are shared with the
+// backend socket.
+func newLocalSource(id string, cfg localSourceConfig, opts wsOptions) *localSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &localSource{
+		id:       id,
+		cfg:      cfg,
+		ctx:      ctx,
+		cancel:   cancel,
+		incoming: make(chan tea.Msg, 8),
+		policy:   opts.Reconnect,
+		recorder: opts.Recorder,
+		seq:      map[string]int64{},
+		topics:   map[string]string{},
+	}
+	s.ingest.Store(opts.Ingest)
+	s.transport = s.newTransport(opts)
+	return s
+}
+
+func (s *localSource) newTransport(opts wsOptions) sourceTransport {
+	switch s.cfg.Kind {
+	case sourceSSE:
+		return &sseTransport{url: s.cfg.URL, client: countingHTTPClient(opts.Transport, &s.wireBytes)}
+	case sourcePoll:
+		return &pollTransport{url: s.cfg.URL, interval: s.cfg.Interval, dataPath: s.cfg.DataPath,
+			client: countingHTTPClient(opts.Transport, &s.wireBytes), wireBytes: &s.wireBytes}
+	case sourceStdin:
+		return &stdinTransport{}
+	case sourceFile:
+		return &fileTransport{path: s.cfg.URL}
+	case sourceTCP, sourceUnix:
+		return &socketTransport{network: s.cfg.Kind, addr: s.cfg.URL, messages: s.cfg.Messages}
+	case sourceMQTT, sourceNATS:
+		u, _ := url.Parse(s.cfg.URL)
+		useTLS := brokerSchemes[s.cfg.Kind][u.Scheme]
+		if s.cfg.Kind == sourceNATS {
+			return &natsTransport{addr: u.Host, useTLS: useTLS, base: opts.Transport,
+				username: s.cfg.Username, password: s.cfg.Password, topics: s.cfg.Topics}
+		}
+		return &mqttTransport{addr: u.Host, useTLS: useTLS, base: opts.Transport,
+			username: s.cfg.Username, password: s.cfg.Password, topics: s.cfg.Topics}
+	}
+	return &wsTransport{
+		url:       s.cfg.URL,
+		messages:  s.cfg.Messages,
+		heartbeat: opts.Heartbeat,
+		client:    countingHTTPClient(opts.Transport, &s.wireBytes),
+		wireBytes: &s.wireBytes,
+		pong: func(rtt time.Duration) {
+			s.ingest.Load().metrics.RecordWSLatency(s.id, rtt, time.Now())
+		},
+	}
+}
+
+// Feed is the synthetic feed shown in the feed list and dashboard. For a
+// broker it stands for the connection; messages go to the topic feeds.
+func (s *localSource) Feed() api.Feed {
+	eventName := s.cfg.EventPath
+	if len(s.cfg.Topics) > 0 {
+		eventName = strings.Join(s.cfg.Topics, ", ")
+	}
+	return api.Feed{
+		ID:             s.id,
+		Name:           s.cfg.Name,
+		Description:    fmt.Sprintf("Local %s source, not registered with the backend", s.cfg.Kind),
+		URL:            s.cfg.URL,
+		Category:       "local",
+		EventName:      eventName,
+		FeedType:       "local",
+		ConnectionType: s.cfg.Kind,
+		IsActive:       true,
+	}
+}
+
+// topicFeed is the synthetic feed for one concrete broker topic.
+func (s *localSource) topicFeed(topic, feedID string) api.Feed {
+	return api.Feed{
+		ID:             feedID,
+		Name:           s.cfg.Name + " " + topic,
+		Description:    fmt.Sprintf("Topic %s on local %s source %s", topic, s.cfg.Kind, s.cfg.Name),
+		URL:            s.cfg.URL,
+		Category:       "local",
+		EventName:      topic,
+		FeedType:       "local",
+		ConnectionType: s.cfg.Kind,
+		IsActive:       true,
+	}
+}
+
+// Feeds is the source's feed followed by a feed per topic seen so far.
+func (s *localSource) Feeds() []api.Feed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	feeds := []api.Feed{s.Feed()}
+	for _, topic := range topics {
+		feeds = append(feeds, s.topicFeed(topic, s.topics[topic]))
+	}
+	return feeds
+}
+
+// Subscriptions mark the synthetic feeds as streaming for as long as the source runs.
+func (s *localSource) Subscriptions() []api.Subscription {
+	feeds := s.Feeds()
+	subs := make([]api.Subscription, len(feeds))
+	for i, f := range feeds {
+		subs[i] = api.Subscription{FeedID: f.ID, IsActive: true}
+	}
+	return subs
+}
+
+// Owns reports whether feedID is the source's feed or one of its topic feeds.
+func (s *localSource) Owns(feedID string) bool {
+	return feedID == s.id || strings.HasPrefix(feedID, s.id+"/")
+}
+
+// feedForTopic returns the feed a broker topic's messages go to, creating it
+// and announcing it to the UI the first time the topic is seen.
+func (s *localSource) feedForTopic(topic string) (string, string) {
+	s.mu.Lock()
+	feedID, ok := s.topics[topic]
+	if !ok {
+		feedID = s.id + "/" + topic
+		s.topics[topic] = feedID
+	}
+	s.mu.Unlock()
+	feed := s.topicFeed(topic, feedID)
+	if !ok {
+		// Metrics must know the feed before its first message is pushed
+		s.ingest.Load().metrics.InitFeed(feedID, feed.Name)
+		s.emitMsg(localTopicMsg{Source: s, Feed: feed})
+	}
+	return feedID, feed.Name
+}
+
+func (s *localSource) Start() {
+	go s.run()
+}
+
+func (s *localSource) Close() {
+	s.cancel()
+}
+
+// SetIngestor points the source at a new ingestor without reconnecting.
+func (s *localSource) SetIngestor(in *ingestor) {
+	s.ingest.Store(in)
+}
+
+func (s *localSource) ListenCmd() tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-s.incoming
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+func (s *localSource) emit(msg localStatusMsg) {
+	msg.Source = s
+	s.emitMsg(msg)
+}
+
+func (s *localSource) emitMsg(msg tea.Msg) {
+	select {
+	case s.incoming <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// run drives the transport until closed, reconnecting with the reconnect policy.
+func (s *localSource) run() {
+	defer close(s.incoming)
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if s.policy.MaxAttempts > 0 && attempt > s.policy.MaxAttempts {
+				s.emit(localStatusMsg{
+					Status: "disconnected",
+					Err:    fmt.Errorf("%s: giving up after %d reconnect attempts: %w", s.cfg.Name, s.policy.MaxAttempts, lastErr),
+				})
+				return
+			}
+			delay := s.policy.Delay(attempt)
+			s.emit(localStatusMsg{Status: "reconnecting", Err: lastErr, RetryAt: time.Now().Add(delay)})
+			timer := time.NewTimer(delay)
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		connected := false
+		err := s.transport.Run(s.ctx, func() {
+			connected = true
+			s.emit(localStatusMsg{Status: "connected"})
+		}, s.deliver)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errSourceEnded) {
+			msg := localStatusMsg{Status: "disconnected"}
+			if err != errSourceEnded {
+				msg.Err = fmt.Errorf("%s: %w", s.cfg.Name, err)
+			}
+			s.emit(msg)
+			return
+		}
+		if connected {
+			attempt = 0
+		}
+		lastErr = fmt.Errorf("%s: %w", s.cfg.Name, err)
+	}
+}
+
+// deliver turns one upstream message into feed-data.
+func (s *localSource) deliver(m sourceMessage) {
+	if s.ctx.Err() != nil {
+		// Closed; the feeds are gone from the UI and metrics
+		return
+	}
+	in := s.ingest.Load()
+	in.metrics.RecordConnectionBytes(s.id, m.Frame.Wire, m.Frame.Decoded)
+	if m.Dropped != "" {
+		in.metrics.RecordPacketLoss(s.id, m.Dropped)
+		return
+	}
+	feedID, feedName := s.id, s.cfg.Name
+	event := m.Event
+	if m.Topic != "" {
+		feedID, feedName = s.feedForTopic(m.Topic)
+		event = m.Topic
+	} else if s.cfg.EventPath != "" || event == "" {
+		event = extractEventName(m.Data, s.cfg.EventPath)
+	}
+	s.seq[feedID]++
+	msg := feedDataMsg{
+		FeedID:    feedID,
+		FeedName:  feedName,
+		EventName: event,
+		Data:      string(m.Data),
+		Time:      time.Now(),
+		Seq:       s.seq[feedID],
+	}
+	s.record(msg, m.Frame)
+	in.Push(msg)
+}
+
+// record writes the message as the feed-data envelope the backend would have
+// sent, so local sources replay like any other feed.
+func (s *localSource) record(msg feedDataMsg, frame frameSize) {
+	if s.recorder == nil {
+		return
+	}
+	data := json.RawMessage(msg.Data)
+	if !json.Valid(data) {
+		data, _ = json.Marshal(msg.Data)
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"type": "feed-data",
+		"payload": feedDataPayload{
+			FeedID:    msg.FeedID,
+			FeedName:  msg.FeedName,
+			EventName: msg.EventName,
+			Data:      data,
+			Timestamp: msg.Time.UTC().Format(time.RFC3339Nano),
+			Seq:       msg.Seq,
+		},
+	})
+	if err == nil {
+		s.recorder.Envelope(raw, frame)
+	}
+}
+
+// wsTransport dials an upstream WebSocket and sends the connection messages.
+type wsTransport struct {
+	url       string
+	messages  []string
+	heartbeat heartbeatPolicy
+	client    *http.Client
+	wireBytes *atomic.Int64
+	pong      func(rtt time.Duration)
+}
+
+func (t *wsTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	conn, _, err := websocket.Dial(ctx, t.url, &websocket.DialOptions{HTTPClient: t.client})
+	if err != nil {
+		return err
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "bye")
+	conn.SetReadLimit(localReadLimit)
+	for _, msg := range t.messages {
+		writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := conn.Write(writeCtx, websocket.MessageText, []byte(msg))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("send connection message: %w", err)
+		}
+	}
+	connected()
+
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go t.runHeartbeat(hbCtx, conn)
+
+	for {
+		before := t.wireBytes.Load()
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+		frame := frameSize{Wire: int(t.wireBytes.Load() - before), Decoded: len(data)}
+		if typ == websocket.MessageBinary {
+			// Accepted when it holds MessagePack, like backend frames
+			raw, err := decodeFrame(typ, data)
+			if err != nil {
+				deliver(sourceMessage{Dropped: "binary_frame"})
+				continue
+			}
+			data = raw
+		}
+		deliver(sourceMessage{Data: data, Frame: frame})
+	}
+}
+
+// runHeartbeat pings the upstream on the heartbeat interval, reports the
+// round trip, and drops the connection when a ping goes unanswered.
+func (t *wsTransport) runHeartbeat(ctx context.Context, conn *websocket.Conn) {
+	if t.heartbeat.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(t.heartbeat.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		timeout := t.heartbeat.Timeout
+		if timeout <= 0 {
+			timeout = t.heartbeat.Interval
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := conn.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			conn.Close(websocket.StatusGoingAway, "heartbeat timeout")
+			return
+		}
+		t.pong(time.Since(start))
+	}
+}
+
+// extractEventName looks up a JSONPath ("$.type", "data.0.e") in a JSON
+// message. Messages without a value there, or that aren't JSON, are named
+// "message".
+func extractEventName(data []byte, path string) string {
+	const fallback = "message"
+	if path == "" {
+		return fallback
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fallback
+	}
+	values, err := evalJSONPath(v, path)
+	if err != nil || len(values) == 0 {
+		return fallback
+	}
+	switch val := values[0].(type) {
+	case string:
+		if val != "" {
+			return val
+		}
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fallback
+}
+
+// statLocalStdin rejects a stdin source when stdin is the terminal the TUI reads keys from.
+func statLocalStdin() error {
+	if term.IsTerminal(os.Stdin.Fd()) {
+		return invalidSource("url", "stdin is a terminal; pipe NDJSON into turbostream-tui to use a stdin source")
+	}
+	return nil
+}
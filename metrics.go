@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math/bits"
 	"sort"
 	"sync"
 	"time"
@@ -22,6 +23,13 @@ type FeedMetrics struct {
 	WSConnected           bool
 	ReconnectsTotal       uint64
 	CurrentUptimeSeconds  float64
+	PingRTTMs             float64 // heartbeat round-trip time - last ping
+	PingRTTAvgMs          float64 // heartbeat round-trip time - 1 minute average
+	LastPongAgeSeconds    float64 // now - last pong; -1 if no pong yet
+
+	// Wire vs inflated bytes of the connection the feed arrives on. Feeds
+	// sharing a connection (every backend feed) show the same totals.
+	Connection ConnectionBytes
 
 	// 2) In-memory cache health (context for LLM)
 	CacheItemsCurrent    int
@@ -32,11 +40,24 @@ type FeedMetrics struct {
 	MessagesDroppedTotal  uint64  // messages not included in LLM context (parse errors, overflow)
 	ContextEvictionsTotal uint64  // older messages evicted when context fills up
 	DropRatePercent       float64 // (dropped / received) * 100
+	GapsTotal             uint64  // unrecoverable holes in the stream after reconnects
+	GapMessagesTotal      uint64  // events lost inside those holes (when sequence numbers are known)
+	GapSecondsTotal       float64 // time covered by those holes
 
 	// 3) Payload size stats (recent window)
 	PayloadSizeLastBytes int
 	PayloadSizeAvgBytes  float64
-	PayloadSizeMaxBytes  int
+	PayloadSizeMaxBytes  int   // largest since the feed was added
+	PayloadSizeMinBytes  int   // smallest in the window
+	PayloadSizeP50Bytes  int   // percentiles over the window
+	PayloadSizeP95Bytes  int   //
+	PayloadSizeP99Bytes  int   //
+	PayloadSizeBuckets   []int // window counts by size; bucket i holds sizes in [2^(i-1), 2^i)
+
+	// Payloads above the outlier threshold; their stream entries are flagged
+	PayloadOutlierBytes  int              // the threshold; 0 disables detection
+	PayloadOutliersTotal uint64           //
+	PayloadOutliers      []PayloadOutlier // most recent last
 
 	// 4) LLM / token usage per feed
 	LLMRequestsTotal          uint64
@@ -44,8 +65,14 @@ type FeedMetrics struct {
 	OutputTokensTotal         uint64  // Total output/response tokens used
 	InputTokensLast           int     // Input tokens in last request
 	OutputTokensLast          int     // Output tokens in last request
+	CachedTokensTotal         uint64  // Prompt tokens served from the provider's cache
+	CachedTokensLast          int     // Cached prompt tokens in last request
+	LLMModel                  string  // model of the last request, when the backend names it
+	TokenEstimator            string  // tokenizer behind the last counts; "" when reported by the backend
+	EstimatedRequestsTotal    uint64  // requests whose token counts are local estimates
 	ContextUtilizationPercent float64 // prompt_tokens / model_context_limit * 100
 	LLMErrorsTotal            uint64
+	LLMCancelledTotal         uint64  // requests stopped by the user before completion
 	EventsInContextCurrent    int     // Number of feed events currently in LLM context
 	TTFTMs                    float64 // Time to First Token (ms) - last request
 	TTFTAvgMs                 float64 // Time to First Token (ms) - average
@@ -59,10 +86,36 @@ type FeedMetrics struct {
 	PayloadSizeHistory []float64 // Payload size history (bytes)
 }
 
+// PayloadOutlier is a message larger than the outlier threshold.
+type PayloadOutlier struct {
+	Time  time.Time
+	Event string
+	Size  int
+}
+
+const (
+	maxPayloadOutliers         = 5        // recent outliers kept per feed
+	defaultPayloadOutlierBytes = 64 << 10 // payloads above this are flagged
+)
+
+// ConnectionBytes counts what one connection read off the network against
+// the frames it decoded. Socket reads are buffered and carry pings and other
+// envelopes, so the counts only add up per connection, never per message.
+type ConnectionBytes struct {
+	Name              string  // backendConnection or a local source's feed ID
+	WireBytesTotal    uint64  // bytes read off the network
+	DecodedBytesTotal uint64  // frame bytes after permessage-deflate
+	CompressionRatio  float64 // decoded / wire; 0 until measured
+}
+
 // DashboardMetrics holds metrics for all feeds
 type DashboardMetrics struct {
 	Feeds       []FeedMetrics
 	SelectedIdx int // index of the currently selected feed
+	// SelectedOutlier is the outlier picked in the Payload panel, counted
+	// from the newest
+	SelectedOutlier int
+	Range           string // trend range read from the history store; empty for the in-memory samples
 }
 
 // MetricsCollector collects and computes metrics from feed data
@@ -76,12 +129,26 @@ type MetricsCollector struct {
 	llmTokenSamples map[string]*tokenSampler
 	startTimes      map[string]time.Time
 	lastMsgTimes    map[string]time.Time
+	pingLatencies   map[string]*slidingWindow
+	lastPongTimes   map[string]time.Time
 
 	// History samplers for sparkline charts
 	msgRateHistory    map[string]*historySampler
 	cacheBytesHistory map[string]*historySampler
 	genTimeHistory    map[string]*historySampler
 	payloadHistory    map[string]*historySampler
+
+	// Cumulative histograms for the Prometheus exporter; guarded by mu
+	payloadHist map[string]*histogram
+	ttftHist    map[string]*histogram
+	genTimeHist map[string]*histogram
+
+	// Recent oversized payloads; guarded by mu
+	outlierBytes    int
+	payloadOutliers map[string][]PayloadOutlier
+
+	// Wire vs decoded bytes per connection; guarded by mu
+	connBytes map[string]*ConnectionBytes
 }
 
 // slidingWindow tracks values over time for rate calculations
@@ -106,7 +173,7 @@ func newSlidingWindow(duration time.Duration) *slidingWindow {
 func (w *slidingWindow) Add(value float64) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
 	w.samples = append(w.samples, windowSample{timestamp: now, value: value})
 	w.prune(now)
 }
@@ -128,7 +195,7 @@ func (w *slidingWindow) prune(now time.Time) {
 func (w *slidingWindow) Rate(windowDuration time.Duration) float64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
 	w.prune(now)
 
 	cutoff := now.Add(-windowDuration)
@@ -144,7 +211,7 @@ func (w *slidingWindow) Rate(windowDuration time.Duration) float64 {
 func (w *slidingWindow) Sum(windowDuration time.Duration) float64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
 	w.prune(now)
 
 	cutoff := now.Add(-windowDuration)
@@ -160,7 +227,7 @@ func (w *slidingWindow) Sum(windowDuration time.Duration) float64 {
 func (w *slidingWindow) Values(windowDuration time.Duration) []float64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
 	w.prune(now)
 
 	cutoff := now.Add(-windowDuration)
@@ -194,11 +261,11 @@ func newPayloadSampler(maxSamples int, duration time.Duration) *payloadSampler {
 func (p *payloadSampler) Add(size int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
 
 	// Prune old samples
 	cutoff := now.Add(-p.duration)
-	idx := 0
+	idx := len(p.times)
 	for i, t := range p.times {
 		if t.After(cutoff) {
 			idx = i
@@ -257,6 +324,26 @@ func (p *payloadSampler) Stats() (min, max int, avg float64, p50, p95, p99 int)
 	return
 }
 
+// Buckets counts the samples by power-of-two size: bucket i holds sizes in
+// [2^(i-1), 2^i), bucket 0 empty payloads. Trailing empty buckets are left out.
+func (p *payloadSampler) Buckets() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var counts []int
+	for _, s := range p.samples {
+		if s < 0 {
+			s = 0
+		}
+		i := bits.Len(uint(s))
+		for len(counts) <= i {
+			counts = append(counts, 0)
+		}
+		counts[i]++
+	}
+	return counts
+}
+
 func (p *payloadSampler) Last() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -279,10 +366,13 @@ type tokenSampler struct {
 	duration          time.Duration
 	totalInputTokens  uint64  // Running total of input tokens
 	totalOutputTokens uint64  // Running total of output tokens
+	totalCachedTokens uint64  // Running total of cached prompt tokens
+	estimated         uint64  // Requests with estimated counts
 	lastInputTokens   int     // Last request input tokens
 	lastOutputTokens  int     // Last request output tokens
 	lastTTFT          float64 // Last request TTFT
 	lastGenTime       float64 // Last request generation time
+	lastUsage         llmUsage
 }
 
 func newTokenSampler(maxSamples int, duration time.Duration) *tokenSampler {
@@ -298,10 +388,11 @@ func newTokenSampler(maxSamples int, duration time.Duration) *tokenSampler {
 	}
 }
 
-func (t *tokenSampler) Add(promptTokens, responseTokens int, ttftMs, genTimeMs float64, eventsInPrompt int) {
+func (t *tokenSampler) Add(usage llmUsage, ttftMs, genTimeMs float64, eventsInPrompt int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	now := time.Now()
+	now := metricsClock()
+	promptTokens, responseTokens := usage.PromptTokens, usage.CompletionTokens
 
 	// Track totals and last values (prevent integer overflow by validating non-negative)
 	if promptTokens > 0 {
@@ -310,6 +401,13 @@ func (t *tokenSampler) Add(promptTokens, responseTokens int, ttftMs, genTimeMs f
 	if responseTokens > 0 {
 		t.totalOutputTokens += uint64(responseTokens)
 	}
+	if usage.CachedTokens > 0 {
+		t.totalCachedTokens += uint64(usage.CachedTokens)
+	}
+	if usage.Estimated() {
+		t.estimated++
+	}
+	t.lastUsage = usage
 	t.lastInputTokens = promptTokens
 	t.lastOutputTokens = responseTokens
 	t.lastTTFT = ttftMs
@@ -341,6 +439,14 @@ func (t *tokenSampler) Add(promptTokens, responseTokens int, ttftMs, genTimeMs f
 	t.times = append(t.times, now)
 }
 
+// Usage returns the last request's usage, the cached prompt tokens so far and
+// how many requests had their counts estimated.
+func (t *tokenSampler) Usage() (last llmUsage, cachedTotal, estimated uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastUsage, t.totalCachedTokens, t.estimated
+}
+
 func (t *tokenSampler) Stats() (inputTotal, outputTotal uint64, inputLast, outputLast int, ttftLast, ttftAvg, genTimeLast, genTimeAvg float64, eventsMax int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -382,6 +488,45 @@ func (t *tokenSampler) Stats() (inputTotal, outputTotal uint64, inputLast, outpu
 	return
 }
 
+// Histogram bucket upper bounds: payload sizes in bytes, LLM timings in seconds.
+var (
+	payloadSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+	ttftBuckets        = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	genTimeBuckets     = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+)
+
+// histogram counts every observation since the feed was added into fixed
+// buckets, the way Prometheus histograms are exposed. Not safe for concurrent
+// use; the collector guards it with its own lock.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// Cumulative returns the count of observations <= each bound, then the total.
+func (h *histogram) Cumulative() []uint64 {
+	out := make([]uint64, len(h.counts))
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		out[i] = total
+	}
+	return out
+}
+
 // historySampler keeps a fixed-size ring buffer of recent values for sparklines
 type historySampler struct {
 	mu      sync.Mutex
@@ -415,6 +560,10 @@ func (h *historySampler) Values() []float64 {
 	return result
 }
 
+// metricsClock is the time source for all windows and rates. Replay swaps it
+// for the recording's clock so rates match what was seen live.
+var metricsClock = time.Now
+
 // NewMetricsCollector creates a new metrics collector
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
@@ -426,13 +575,47 @@ func NewMetricsCollector() *MetricsCollector {
 		llmTokenSamples:   make(map[string]*tokenSampler),
 		startTimes:        make(map[string]time.Time),
 		lastMsgTimes:      make(map[string]time.Time),
+		pingLatencies:     make(map[string]*slidingWindow),
+		lastPongTimes:     make(map[string]time.Time),
 		msgRateHistory:    make(map[string]*historySampler),
 		cacheBytesHistory: make(map[string]*historySampler),
 		genTimeHistory:    make(map[string]*historySampler),
 		payloadHistory:    make(map[string]*historySampler),
+		payloadHist:       make(map[string]*histogram),
+		ttftHist:          make(map[string]*histogram),
+		genTimeHist:       make(map[string]*histogram),
+		outlierBytes:      defaultPayloadOutlierBytes,
+		payloadOutliers:   make(map[string][]PayloadOutlier),
+		connBytes:         make(map[string]*ConnectionBytes),
 	}
 }
 
+// Reset forgets every feed, e.g. when a replay seeks backwards.
+func (mc *MetricsCollector) Reset() {
+	fresh := NewMetricsCollector()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.feedMetrics = fresh.feedMetrics
+	mc.messageWindows = fresh.messageWindows
+	mc.byteWindows = fresh.byteWindows
+	mc.payloadSamples = fresh.payloadSamples
+	mc.llmLatencies = fresh.llmLatencies
+	mc.llmTokenSamples = fresh.llmTokenSamples
+	mc.startTimes = fresh.startTimes
+	mc.lastMsgTimes = fresh.lastMsgTimes
+	mc.pingLatencies = fresh.pingLatencies
+	mc.lastPongTimes = fresh.lastPongTimes
+	mc.msgRateHistory = fresh.msgRateHistory
+	mc.cacheBytesHistory = fresh.cacheBytesHistory
+	mc.genTimeHistory = fresh.genTimeHistory
+	mc.payloadHistory = fresh.payloadHistory
+	mc.payloadHist = fresh.payloadHist
+	mc.ttftHist = fresh.ttftHist
+	mc.genTimeHist = fresh.genTimeHist
+	mc.payloadOutliers = fresh.payloadOutliers
+	mc.connBytes = fresh.connBytes
+}
+
 // InitFeed initializes metrics for a feed
 func (mc *MetricsCollector) InitFeed(feedID, name string) {
 	mc.mu.Lock()
@@ -442,23 +625,75 @@ func (mc *MetricsCollector) InitFeed(feedID, name string) {
 		mc.feedMetrics[feedID] = &FeedMetrics{
 			FeedID:      feedID,
 			Name:        name,
-			LastUpdated: time.Now(),
+			LastUpdated: metricsClock(),
 		}
 		mc.messageWindows[feedID] = newSlidingWindow(time.Minute)
 		mc.byteWindows[feedID] = newSlidingWindow(time.Minute)
 		mc.payloadSamples[feedID] = newPayloadSampler(1000, 5*time.Minute)
 		mc.llmLatencies[feedID] = newSlidingWindow(5 * time.Minute)
 		mc.llmTokenSamples[feedID] = newTokenSampler(100, 5*time.Minute)
-		mc.startTimes[feedID] = time.Now()
+		mc.pingLatencies[feedID] = newSlidingWindow(time.Minute)
+		mc.startTimes[feedID] = metricsClock()
 
 		// History samplers for sparklines (keep last 30 samples)
 		mc.msgRateHistory[feedID] = newHistorySampler(30)
 		mc.cacheBytesHistory[feedID] = newHistorySampler(30)
 		mc.genTimeHistory[feedID] = newHistorySampler(30)
 		mc.payloadHistory[feedID] = newHistorySampler(30)
+
+		mc.payloadHist[feedID] = newHistogram(payloadSizeBuckets)
+		mc.ttftHist[feedID] = newHistogram(ttftBuckets)
+		mc.genTimeHist[feedID] = newHistogram(genTimeBuckets)
 	}
 }
 
+// RemoveFeed forgets a feed, e.g. when a local source is closed.
+func (mc *MetricsCollector) RemoveFeed(feedID string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	delete(mc.feedMetrics, feedID)
+	delete(mc.messageWindows, feedID)
+	delete(mc.byteWindows, feedID)
+	delete(mc.payloadSamples, feedID)
+	delete(mc.llmLatencies, feedID)
+	delete(mc.llmTokenSamples, feedID)
+	delete(mc.startTimes, feedID)
+	delete(mc.lastMsgTimes, feedID)
+	delete(mc.pingLatencies, feedID)
+	delete(mc.lastPongTimes, feedID)
+	delete(mc.msgRateHistory, feedID)
+	delete(mc.cacheBytesHistory, feedID)
+	delete(mc.genTimeHistory, feedID)
+	delete(mc.payloadHistory, feedID)
+	delete(mc.payloadHist, feedID)
+	delete(mc.ttftHist, feedID)
+	delete(mc.genTimeHist, feedID)
+	delete(mc.payloadOutliers, feedID)
+	delete(mc.connBytes, feedID) // a local source's connection goes with its feed
+}
+
+// RemoveBackendFeeds forgets every backend feed and the backend connection's
+// byte counts, e.g. when a profile switch moves to another backend. Local
+// sources keep their metrics.
+func (mc *MetricsCollector) RemoveBackendFeeds() {
+	mc.mu.RLock()
+	var backend []string
+	for feedID := range mc.feedMetrics {
+		if !isLocalFeed(feedID) {
+			backend = append(backend, feedID)
+		}
+	}
+	mc.mu.RUnlock()
+
+	for _, feedID := range backend {
+		mc.RemoveFeed(feedID)
+	}
+	mc.mu.Lock()
+	delete(mc.connBytes, backendConnection)
+	mc.mu.Unlock()
+}
+
 // RecordMessage records a received message for a feed
 func (mc *MetricsCollector) RecordMessage(feedID string, payloadSize int) {
 	mc.mu.Lock()
@@ -477,8 +712,9 @@ func (mc *MetricsCollector) RecordMessage(feedID string, payloadSize int) {
 	if payloadSize > fm.PayloadSizeMaxBytes {
 		fm.PayloadSizeMaxBytes = payloadSize
 	}
-	fm.LastUpdated = time.Now()
-	mc.lastMsgTimes[feedID] = time.Now()
+	fm.LastUpdated = metricsClock()
+	mc.lastMsgTimes[feedID] = metricsClock()
+	mc.payloadHist[feedID].Observe(float64(payloadSize))
 
 	msgWindow := mc.messageWindows[feedID]
 	byteWindow := mc.byteWindows[feedID]
@@ -491,6 +727,69 @@ func (mc *MetricsCollector) RecordMessage(feedID string, payloadSize int) {
 	sampler.Add(payloadSize)
 }
 
+// SetPayloadOutlierBytes sets the size above which payloads are outliers; 0
+// turns detection off.
+func (mc *MetricsCollector) SetPayloadOutlierBytes(n int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.outlierBytes = n
+}
+
+// RecordPayloadOutlier remembers a payload if it is above the outlier
+// threshold and reports whether it was.
+func (mc *MetricsCollector) RecordPayloadOutlier(feedID, event string, size int, at time.Time) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	fm, exists := mc.feedMetrics[feedID]
+	if !exists || mc.outlierBytes <= 0 || size <= mc.outlierBytes {
+		return false
+	}
+	fm.PayloadOutliersTotal++
+	outliers := append(mc.payloadOutliers[feedID], PayloadOutlier{Time: at, Event: event, Size: size})
+	if len(outliers) > maxPayloadOutliers {
+		outliers = outliers[len(outliers)-maxPayloadOutliers:]
+	}
+	mc.payloadOutliers[feedID] = outliers
+	return true
+}
+
+// RecordConnectionBytes adds one socket read to a connection's totals: the
+// bytes it took off the network and the size of the frame it decoded.
+func (mc *MetricsCollector) RecordConnectionBytes(conn string, wire, decoded int) {
+	if wire < 0 || decoded < 0 {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	cb, exists := mc.connBytes[conn]
+	if !exists {
+		cb = &ConnectionBytes{Name: conn}
+		mc.connBytes[conn] = cb
+	}
+	cb.WireBytesTotal += uint64(wire)
+	cb.DecodedBytesTotal += uint64(decoded)
+	if cb.WireBytesTotal > 0 {
+		cb.CompressionRatio = float64(cb.DecodedBytesTotal) / float64(cb.WireBytesTotal)
+	}
+}
+
+// Connections returns every connection's byte totals, sorted by name.
+func (mc *MetricsCollector) Connections() []ConnectionBytes {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	conns := make([]ConnectionBytes, 0, len(mc.connBytes))
+	for _, cb := range mc.connBytes {
+		conns = append(conns, *cb)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Name < conns[j].Name
+	})
+	return conns
+}
+
 // RecordWSStatus records WebSocket connection status
 func (mc *MetricsCollector) RecordWSStatus(feedID string, connected bool) {
 	mc.mu.Lock()
@@ -506,12 +805,30 @@ func (mc *MetricsCollector) RecordWSStatus(feedID string, connected bool) {
 
 	if !connected && wasConnected {
 		fm.ReconnectsTotal++
-		mc.startTimes[feedID] = time.Now() // Reset uptime
+		mc.startTimes[feedID] = metricsClock() // Reset uptime
 	} else if connected && !wasConnected {
-		mc.startTimes[feedID] = time.Now()
+		mc.startTimes[feedID] = metricsClock()
 	}
 }
 
+// RecordWSLatency records a heartbeat round trip on the feed's socket
+func (mc *MetricsCollector) RecordWSLatency(feedID string, rtt time.Duration, at time.Time) {
+	mc.mu.Lock()
+	fm, exists := mc.feedMetrics[feedID]
+	if !exists {
+		mc.mu.Unlock()
+		return
+	}
+
+	rttMs := float64(rtt.Microseconds()) / 1000
+	fm.PingRTTMs = rttMs
+	mc.lastPongTimes[feedID] = at
+	window := mc.pingLatencies[feedID]
+	mc.mu.Unlock()
+
+	window.Add(rttMs)
+}
+
 // RecordCacheStats records cache statistics
 func (mc *MetricsCollector) RecordCacheStats(feedID string, itemCount int, approxBytes uint64, oldestAge float64) {
 	mc.mu.Lock()
@@ -544,6 +861,25 @@ func (mc *MetricsCollector) RecordPacketLoss(feedID string, reason string) {
 	}
 }
 
+// RecordGap records a range of events that was lost and could not be replayed
+func (mc *MetricsCollector) RecordGap(feedID string, missed int64, span time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	fm, exists := mc.feedMetrics[feedID]
+	if !exists {
+		return
+	}
+
+	fm.GapsTotal++
+	if missed > 0 {
+		fm.GapMessagesTotal += uint64(missed)
+	}
+	if span > 0 {
+		fm.GapSecondsTotal += span.Seconds()
+	}
+}
+
 // RecordContextEviction records when older messages are evicted from context
 func (mc *MetricsCollector) RecordContextEviction(feedID string, count int) {
 	mc.mu.Lock()
@@ -561,7 +897,7 @@ func (mc *MetricsCollector) RecordContextEviction(feedID string, count int) {
 }
 
 // RecordLLMRequest records an LLM request with token counts and timing
-func (mc *MetricsCollector) RecordLLMRequest(feedID string, inputTokens, outputTokens int, ttftMs, genTimeMs float64, eventsInContext int, isError bool) {
+func (mc *MetricsCollector) RecordLLMRequest(feedID string, usage llmUsage, ttftMs, genTimeMs float64, eventsInContext int, isError bool) {
 	mc.mu.Lock()
 	fm, exists := mc.feedMetrics[feedID]
 	if !exists {
@@ -573,12 +909,34 @@ func (mc *MetricsCollector) RecordLLMRequest(feedID string, inputTokens, outputT
 	fm.EventsInContextCurrent = eventsInContext
 	if isError {
 		fm.LLMErrorsTotal++
+	} else {
+		if ttftMs > 0 {
+			mc.ttftHist[feedID].Observe(ttftMs / 1000)
+		}
+		if genTimeMs > 0 {
+			mc.genTimeHist[feedID].Observe(genTimeMs / 1000)
+		}
 	}
 
 	sampler := mc.llmTokenSamples[feedID]
 	mc.mu.Unlock()
 
-	sampler.Add(inputTokens, outputTokens, ttftMs, genTimeMs, eventsInContext)
+	sampler.Add(usage, ttftMs, genTimeMs, eventsInContext)
+}
+
+// RecordLLMCancellation records a request the user cancelled mid-stream.
+// Cancellations are counted separately from errors and carry no timing sample.
+func (mc *MetricsCollector) RecordLLMCancellation(feedID string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	fm, exists := mc.feedMetrics[feedID]
+	if !exists {
+		return
+	}
+
+	fm.LLMRequestsTotal++
+	fm.LLMCancelledTotal++
 }
 
 // GetMetrics returns computed metrics for all feeds
@@ -586,55 +944,11 @@ func (mc *MetricsCollector) GetMetrics() DashboardMetrics {
 	mc.mu.RLock()
 	defer mc.mu.RUnlock()
 
-	now := time.Now()
+	now := metricsClock()
 	var feeds []FeedMetrics
 
 	for feedID, fm := range mc.feedMetrics {
-		// Copy the metrics
-		metrics := *fm
-
-		// Compute rates (10s window)
-		if msgWindow, ok := mc.messageWindows[feedID]; ok {
-			metrics.MessagesPerSecond10s = msgWindow.Rate(10 * time.Second)
-		}
-
-		if byteWindow, ok := mc.byteWindows[feedID]; ok {
-			metrics.BytesPerSecond10s = byteWindow.Rate(10 * time.Second)
-		}
-
-		// Compute payload stats
-		if sampler, ok := mc.payloadSamples[feedID]; ok {
-			_, _, avg, _, _, _ := sampler.Stats()
-			metrics.PayloadSizeAvgBytes = avg
-		}
-
-		// Compute LLM stats
-		if sampler, ok := mc.llmTokenSamples[feedID]; ok {
-			inputTotal, outputTotal, inputLast, outputLast, ttftLast, ttftAvg, genTimeLast, genTimeAvg, eventsMax := sampler.Stats()
-			metrics.InputTokensTotal = inputTotal
-			metrics.OutputTokensTotal = outputTotal
-			metrics.InputTokensLast = inputLast
-			metrics.OutputTokensLast = outputLast
-			metrics.TTFTMs = ttftLast
-			metrics.TTFTAvgMs = ttftAvg
-			metrics.GenerationTimeMs = genTimeLast
-			metrics.GenerationTimeAvgMs = genTimeAvg
-
-			// Context utilization (assume 128K context window for GPT-4o)
-			const modelContextLimit = 128000
-			if inputLast > 0 {
-				metrics.ContextUtilizationPercent = (float64(inputLast) / modelContextLimit) * 100
-			}
-			_ = eventsMax // Not used in simplified metrics
-		}
-
-		// Compute uptime and last message age
-		if startTime, ok := mc.startTimes[feedID]; ok {
-			metrics.CurrentUptimeSeconds = now.Sub(startTime).Seconds()
-		}
-		if lastMsg, ok := mc.lastMsgTimes[feedID]; ok {
-			metrics.LastMessageAgeSeconds = now.Sub(lastMsg).Seconds()
-		}
+		metrics := mc.snapshotLocked(feedID, fm, now)
 
 		// Sample history for sparklines (called on each dashboard refresh ~1s)
 		if sampler, ok := mc.msgRateHistory[feedID]; ok {
@@ -649,6 +963,10 @@ func (mc *MetricsCollector) GetMetrics() DashboardMetrics {
 			sampler.Add(metrics.GenerationTimeMs)
 			metrics.GenTimeHistory = sampler.Values()
 		}
+		if sampler, ok := mc.payloadHistory[feedID]; ok {
+			sampler.Add(metrics.PayloadSizeAvgBytes)
+			metrics.PayloadSizeHistory = sampler.Values()
+		}
 
 		feeds = append(feeds, metrics)
 	}
@@ -664,6 +982,89 @@ func (mc *MetricsCollector) GetMetrics() DashboardMetrics {
 	}
 }
 
+// snapshotLocked copies a feed's metrics and fills in the values computed
+// from its windows and samplers. Caller must hold mc.mu.
+func (mc *MetricsCollector) snapshotLocked(feedID string, fm *FeedMetrics, now time.Time) FeedMetrics {
+	metrics := *fm
+
+	// Compute rates (10s window)
+	if msgWindow, ok := mc.messageWindows[feedID]; ok {
+		metrics.MessagesPerSecond10s = msgWindow.Rate(10 * time.Second)
+	}
+
+	if byteWindow, ok := mc.byteWindows[feedID]; ok {
+		metrics.BytesPerSecond10s = byteWindow.Rate(10 * time.Second)
+	}
+
+	// Compute payload stats
+	if sampler, ok := mc.payloadSamples[feedID]; ok {
+		minSize, _, avg, p50, p95, p99 := sampler.Stats()
+		metrics.PayloadSizeMinBytes = minSize
+		metrics.PayloadSizeAvgBytes = avg
+		metrics.PayloadSizeP50Bytes = p50
+		metrics.PayloadSizeP95Bytes = p95
+		metrics.PayloadSizeP99Bytes = p99
+		metrics.PayloadSizeBuckets = sampler.Buckets()
+	}
+	metrics.PayloadOutlierBytes = mc.outlierBytes
+	metrics.PayloadOutliers = append([]PayloadOutlier(nil), mc.payloadOutliers[feedID]...)
+	if cb, ok := mc.connBytes[feedConnection(feedID)]; ok {
+		metrics.Connection = *cb
+	}
+
+	// Compute LLM stats
+	if sampler, ok := mc.llmTokenSamples[feedID]; ok {
+		inputTotal, outputTotal, inputLast, outputLast, ttftLast, ttftAvg, genTimeLast, genTimeAvg, eventsMax := sampler.Stats()
+		metrics.InputTokensTotal = inputTotal
+		metrics.OutputTokensTotal = outputTotal
+		metrics.InputTokensLast = inputLast
+		metrics.OutputTokensLast = outputLast
+		metrics.TTFTMs = ttftLast
+		metrics.TTFTAvgMs = ttftAvg
+		metrics.GenerationTimeMs = genTimeLast
+		metrics.GenerationTimeAvgMs = genTimeAvg
+		last, cachedTotal, estimated := sampler.Usage()
+		metrics.CachedTokensTotal = cachedTotal
+		metrics.CachedTokensLast = last.CachedTokens
+		metrics.LLMModel = last.Model
+		metrics.TokenEstimator = last.Estimator
+		metrics.EstimatedRequestsTotal = estimated
+
+		// Context utilization against the model's window (128K when unknown)
+		if inputLast > 0 {
+			metrics.ContextUtilizationPercent = (float64(inputLast) / float64(contextWindow(last.Model))) * 100
+		}
+		_ = eventsMax // Not used in simplified metrics
+	}
+
+	// Compute uptime and last message age
+	if startTime, ok := mc.startTimes[feedID]; ok {
+		metrics.CurrentUptimeSeconds = now.Sub(startTime).Seconds()
+	}
+	if lastMsg, ok := mc.lastMsgTimes[feedID]; ok {
+		metrics.LastMessageAgeSeconds = now.Sub(lastMsg).Seconds()
+	}
+	mc.fillPingStats(feedID, &metrics, now)
+	return metrics
+}
+
+// fillPingStats computes heartbeat latency and pong age. Caller must hold mc.mu.
+func (mc *MetricsCollector) fillPingStats(feedID string, metrics *FeedMetrics, now time.Time) {
+	metrics.LastPongAgeSeconds = -1
+	if lastPong, ok := mc.lastPongTimes[feedID]; ok {
+		metrics.LastPongAgeSeconds = now.Sub(lastPong).Seconds()
+	}
+	if window, ok := mc.pingLatencies[feedID]; ok {
+		if values := window.Values(time.Minute); len(values) > 0 {
+			var sum float64
+			for _, v := range values {
+				sum += v
+			}
+			metrics.PingRTTAvgMs = sum / float64(len(values))
+		}
+	}
+}
+
 // GetFeedMetrics returns metrics for a specific feed
 func (mc *MetricsCollector) GetFeedMetrics(feedID string) *FeedMetrics {
 	mc.mu.RLock()
@@ -673,7 +1074,7 @@ func (mc *MetricsCollector) GetFeedMetrics(feedID string) *FeedMetrics {
 		metrics := *fm
 
 		// Compute real-time rates
-		now := time.Now()
+		now := metricsClock()
 		if msgWindow, ok := mc.messageWindows[feedID]; ok {
 			metrics.MessagesPerSecond10s = msgWindow.Rate(10 * time.Second)
 		}
@@ -693,6 +1094,7 @@ func (mc *MetricsCollector) GetFeedMetrics(feedID string) *FeedMetrics {
 		if lastMsg, ok := mc.lastMsgTimes[feedID]; ok {
 			metrics.LastMessageAgeSeconds = now.Sub(lastMsg).Seconds()
 		}
+		mc.fillPingStats(feedID, &metrics, now)
 
 		return &metrics
 	}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemoveBackendFeedsKeepsLocalSources(t *testing.T) {
+	mc := NewMetricsCollector()
+	for _, feedID := range []string{"backend-1", "backend-2", "local:1", "local:2/sensors/a/temp"} {
+		mc.InitFeed(feedID, feedID)
+		mc.RecordMessage(feedID, 10)
+		mc.RecordConnectionBytes(feedConnection(feedID), 5, 10)
+	}
+
+	mc.RemoveBackendFeeds()
+
+	var kept []string
+	for _, fm := range mc.GetMetrics().Feeds {
+		kept = append(kept, fm.FeedID)
+	}
+	if len(kept) != 2 || !isLocalFeed(kept[0]) || !isLocalFeed(kept[1]) {
+		t.Errorf("feeds after RemoveBackendFeeds = %v, want only the local ones", kept)
+	}
+	for _, conn := range mc.Connections() {
+		if conn.Name == backendConnection {
+			t.Errorf("backend connection bytes survived: %+v", conn)
+		}
+	}
+}
+
+func TestConnectionBytesSharedByFeeds(t *testing.T) {
+	mc := NewMetricsCollector()
+	mc.InitFeed("a", "a")
+	mc.InitFeed("b", "b")
+	mc.RecordConnectionBytes(backendConnection, 100, 400)
+	mc.RecordConnectionBytes(backendConnection, 0, 100) // frame decoded from an earlier read
+	mc.RecordConnectionBytes(backendConnection, -1, 50) // ignored
+
+	for _, fm := range mc.GetMetrics().Feeds {
+		c := fm.Connection
+		if c.WireBytesTotal != 100 || c.DecodedBytesTotal != 500 || c.CompressionRatio != 5 {
+			t.Errorf("feed %s connection = %+v, want 100 wire, 500 decoded, ratio 5", fm.FeedID, c)
+		}
+	}
+}
+
+func TestRecordGap(t *testing.T) {
+	tests := []struct {
+		name        string
+		missed      int64
+		span        time.Duration
+		wantMissed  uint64
+		wantSeconds float64
+	}{
+		{"sequence and time", 3, 2 * time.Second, 3, 2},
+		{"unknown count", 0, time.Second, 0, 1},
+		{"no timestamps on one side", 5, 0, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := NewMetricsCollector()
+			mc.InitFeed("f", "f")
+			mc.RecordGap("f", tt.missed, tt.span)
+			fm := mc.GetMetrics().Feeds[0]
+			if fm.GapsTotal != 1 || fm.GapMessagesTotal != tt.wantMissed || fm.GapSecondsTotal != tt.wantSeconds {
+				t.Errorf("gaps %d, missed %d, seconds %v; want 1, %d, %v",
+					fm.GapsTotal, fm.GapMessagesTotal, fm.GapSecondsTotal, tt.wantMissed, tt.wantSeconds)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// wsCommand is an outbound request that the backend confirms with a success or
+// failure envelope. The envelope is built when the command is written so that
+// resend after a reconnect picks up the latest resume cursor.
+type wsCommand struct {
+	ID     string
+	Action string // "subscribe" or "unsubscribe"
+	FeedID string
+	SentAt time.Time
+	build  func(requestID string) map[string]interface{}
+}
+
+// wsOutbox buffers commands while the socket is down and tracks the ones
+// written but not yet acknowledged.
+type wsOutbox struct {
+	mu       sync.Mutex
+	pending  []*wsCommand
+	inflight map[string]*wsCommand
+	nextID   uint64
+	timeout  time.Duration
+
+	flushMu sync.Mutex // serialises writers so commands go out in order
+}
+
+func newWSOutbox(timeout time.Duration) *wsOutbox {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &wsOutbox{
+		inflight: make(map[string]*wsCommand),
+		timeout:  timeout,
+	}
+}
+
+// add queues a command. Earlier commands for the same feed are superseded:
+// only the latest intent is sent and reported.
+func (o *wsOutbox) add(action, feedID string, build func(requestID string) map[string]interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	kept := o.pending[:0]
+	for _, cmd := range o.pending {
+		if cmd.FeedID != feedID {
+			kept = append(kept, cmd)
+		}
+	}
+	o.pending = kept
+	for id, cmd := range o.inflight {
+		if cmd.FeedID == feedID {
+			delete(o.inflight, id)
+		}
+	}
+
+	o.nextID++
+	o.pending = append(o.pending, &wsCommand{
+		ID:     fmt.Sprintf("cmd-%d", o.nextID),
+		Action: action,
+		FeedID: feedID,
+		build:  build,
+	})
+}
+
+// hasPending reports whether a command for the feed is queued or awaiting an ack.
+func (o *wsOutbox) hasPending(feedID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, cmd := range o.pending {
+		if cmd.FeedID == feedID {
+			return true
+		}
+	}
+	for _, cmd := range o.inflight {
+		if cmd.FeedID == feedID {
+			return true
+		}
+	}
+	return false
+}
+
+// requeue moves unacknowledged commands back to the front of the queue after
+// the connection drops; the new connection never saw them.
+func (o *wsOutbox) requeue() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.inflight) == 0 {
+		return
+	}
+	sent := make([]*wsCommand, 0, len(o.inflight))
+	for _, cmd := range o.inflight {
+		sent = append(sent, cmd)
+	}
+	sort.Slice(sent, func(i, j int) bool {
+		return sent[i].SentAt.Before(sent[j].SentAt)
+	})
+	o.pending = append(sent, o.pending...)
+	o.inflight = make(map[string]*wsCommand)
+}
+
+// resolve matches an acknowledgement to its command, by request ID when the
+// backend echoes it, otherwise by the oldest command for the feed, and for
+// acks that name neither, by the oldest command of the same action.
+func (o *wsOutbox) resolve(requestID, action, feedID string) (*wsCommand, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if requestID != "" {
+		// A superseded command's ack must not resolve its replacement
+		cmd, ok := o.inflight[requestID]
+		if ok {
+			delete(o.inflight, requestID)
+		}
+		return cmd, ok
+	}
+	var match *wsCommand
+	for _, cmd := range o.inflight {
+		if cmd.Action == action && (feedID == "" || cmd.FeedID == feedID) && (match == nil || cmd.SentAt.Before(match.SentAt)) {
+			match = cmd
+		}
+	}
+	if match == nil {
+		return nil, false
+	}
+	delete(o.inflight, match.ID)
+	return match, true
+}
+
+// expired removes and returns commands that waited longer than the timeout.
+func (o *wsOutbox) expired(now time.Time) []*wsCommand {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var out []*wsCommand
+	for id, cmd := range o.inflight {
+		if now.Sub(cmd.SentAt) > o.timeout {
+			delete(o.inflight, id)
+			out = append(out, cmd)
+		}
+	}
+	return out
+}
+
+// kick wakes the writer so queued commands go out without the caller
+// touching the socket.
+func (c *wsClient) kick() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runWriter sends queued commands whenever the outbox is kicked, starting
+// with whatever was queued while the socket was down.
+func (c *wsClient) runWriter(ctx context.Context) {
+	for {
+		c.flush()
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+		}
+	}
+}
+
+// flush writes queued commands in order until the queue is empty or a write
+// fails; unsent commands stay queued for the next connection.
+func (c *wsClient) flush() {
+	c.outbox.flushMu.Lock()
+	defer c.outbox.flushMu.Unlock()
+
+	for {
+		conn := c.currentConn()
+		if conn == nil {
+			return
+		}
+
+		c.outbox.mu.Lock()
+		if len(c.outbox.pending) == 0 {
+			c.outbox.mu.Unlock()
+			return
+		}
+		cmd := c.outbox.pending[0]
+		c.outbox.pending = c.outbox.pending[1:]
+		cmd.SentAt = time.Now()
+		c.outbox.inflight[cmd.ID] = cmd
+		c.outbox.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+		err := wsjson.Write(ctx, conn, cmd.build(cmd.ID))
+		cancel()
+		if err != nil {
+			c.outbox.mu.Lock()
+			if _, still := c.outbox.inflight[cmd.ID]; still {
+				delete(c.outbox.inflight, cmd.ID)
+				c.outbox.pending = append([]*wsCommand{cmd}, c.outbox.pending...)
+			}
+			c.outbox.mu.Unlock()
+			return
+		}
+	}
+}
+
+// acknowledge turns a success or failure envelope into a result for the UI.
+// Acks for superseded or already expired commands are ignored.
+func (c *wsClient) acknowledge(requestID, action, feedID, errText string) tea.Msg {
+	cmd, ok := c.outbox.resolve(requestID, action, feedID)
+	if !ok {
+		if !c.replaying {
+			return nil
+		}
+		// A replayed ack answers a command sent while recording
+		cmd = &wsCommand{ID: requestID, Action: action, FeedID: feedID}
+	}
+	result := wsCommandResultMsg{ID: cmd.ID, Action: cmd.Action, FeedID: cmd.FeedID}
+	if errText != "" {
+		result.Err = errors.New(errText)
+	}
+	return result
+}
+
+// runAckTimer reports commands whose acknowledgement never arrived. Some
+// backends don't confirm at all, so these count as sent, not as failed.
+func (c *wsClient) runAckTimer(ctx context.Context) {
+	interval := c.outbox.timeout / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, cmd := range c.outbox.expired(now) {
+				c.emit(wsCommandResultMsg{
+					ID:          cmd.ID,
+					Action:      cmd.Action,
+					FeedID:      cmd.FeedID,
+					Unconfirmed: true,
+				})
+			}
+		}
+	}
+}
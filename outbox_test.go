@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxResolve(t *testing.T) {
+	sent := time.Unix(1700000000, 0)
+	inflight := func() *wsOutbox {
+		o := newWSOutbox(time.Second)
+		for i, c := range []struct{ action, feedID string }{
+			{"subscribe", "a"},
+			{"subscribe", "b"},
+			{"unsubscribe", "c"},
+		} {
+			o.add(c.action, c.feedID, nil)
+			cmd := o.pending[len(o.pending)-1]
+			cmd.SentAt = sent.Add(time.Duration(i) * time.Second)
+			o.inflight[cmd.ID] = cmd
+		}
+		o.pending = nil
+		return o
+	}
+
+	tests := []struct {
+		name      string
+		requestID string
+		action    string
+		feedID    string
+		want      string // FeedID of the resolved command, "" for no match
+	}{
+		{"by request ID", "cmd-2", "subscribe", "", "b"},
+		{"unknown request ID", "cmd-9", "subscribe", "a", ""},
+		{"by feed", "", "subscribe", "b", "b"},
+		{"feed with other action", "", "unsubscribe", "a", ""},
+		{"neither echoed takes oldest of action", "", "subscribe", "", "a"},
+		{"neither echoed unsubscribe", "", "unsubscribe", "", "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := inflight()
+			cmd, ok := o.resolve(tt.requestID, tt.action, tt.feedID)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("resolved %+v, want no match", cmd)
+				}
+				return
+			}
+			if !ok || cmd.FeedID != tt.want {
+				t.Fatalf("resolved %+v (ok=%v), want feed %s", cmd, ok, tt.want)
+			}
+			if _, still := o.inflight[cmd.ID]; still {
+				t.Error("resolved command is still in flight")
+			}
+		})
+	}
+}
+
+func TestOutboxSupersedesAndExpires(t *testing.T) {
+	o := newWSOutbox(time.Second)
+	o.add("subscribe", "a", nil)
+	o.add("unsubscribe", "a", nil)
+	if len(o.pending) != 1 || o.pending[0].Action != "unsubscribe" {
+		t.Fatalf("pending = %+v, want only the unsubscribe", o.pending)
+	}
+
+	cmd := o.pending[0]
+	o.pending = nil
+	cmd.SentAt = time.Unix(100, 0)
+	o.inflight[cmd.ID] = cmd
+	if got := o.expired(time.Unix(100, 0).Add(500 * time.Millisecond)); len(got) != 0 {
+		t.Fatalf("expired early: %+v", got)
+	}
+	if got := o.expired(time.Unix(102, 0)); len(got) != 1 || got[0] != cmd {
+		t.Fatalf("expired = %+v, want the unsubscribe", got)
+	}
+	if o.hasPending("a") {
+		t.Error("expired command still counts as pending")
+	}
+}
+
+func TestOutboxRequeueKeepsSendOrder(t *testing.T) {
+	o := newWSOutbox(time.Second)
+	for i, feedID := range []string{"a", "b"} {
+		o.add("subscribe", feedID, nil)
+		cmd := o.pending[len(o.pending)-1]
+		cmd.SentAt = time.Unix(int64(10-i), 0) // b was sent first
+		o.inflight[cmd.ID] = cmd
+	}
+	o.pending = nil
+	o.add("subscribe", "c", nil)
+
+	o.requeue()
+	var order []string
+	for _, cmd := range o.pending {
+		order = append(order, cmd.FeedID)
+	}
+	if got := len(order); got != 3 || order[0] != "b" || order[1] != "a" || order[2] != "c" {
+		t.Fatalf("pending order = %v, want [b a c]", order)
+	}
+	if len(o.inflight) != 0 {
+		t.Errorf("%d commands left in flight", len(o.inflight))
+	}
+}
@@ -16,6 +16,7 @@ import (
 type HTTPError struct {
 	StatusCode int
 	Body       string
+	RetryAfter time.Duration // from the Retry-After header, 0 if absent
 }
 
 func (e *HTTPError) Error() string {
@@ -27,6 +28,8 @@ type Client struct {
 	baseURL    string
 	token      string
 	httpClient *http.Client
+	retry      RetryPolicy
+	tracer     Tracer
 }
 
 func NewClient(baseURL string) *Client {
@@ -35,9 +38,15 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 20 * time.Second,
 		},
+		retry: DefaultRetryPolicy(),
 	}
 }
 
+// SetTransport routes all requests through rt, e.g. one built by NewTransport.
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
 func (c *Client) SetToken(token string) {
 	c.token = token
 }
@@ -93,56 +102,62 @@ type (
 	}
 )
 
-// Login authenticates and returns token plus user.
-func (c *Client) Login(ctx context.Context, email, password, totp string) (string, *User, error) {
+// Session is what the backend returns on login, registration and refresh.
+// RefreshToken is empty when the backend does not issue refresh tokens.
+type Session struct {
+	Token        string
+	RefreshToken string
+	User         *User
+}
+
+type sessionResponse struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	User         *User  `json:"user"`
+}
+
+func (r sessionResponse) session() *Session {
+	return &Session{Token: r.Token, RefreshToken: r.RefreshToken, User: r.User}
+}
+
+// Login authenticates and returns the new session.
+func (c *Client) Login(ctx context.Context, email, password, totp string) (*Session, error) {
 	payload := map[string]string{"email": email, "password": password}
 	if totp != "" {
 		payload["totpToken"] = totp
 	}
-	var resp struct {
-		Success           bool   `json:"success"`
-		Message           string `json:"message"`
-		Token             string `json:"token"`
-		User              *User  `json:"user"`
-		RequiresTwoFactor bool   `json:"requiresTwoFactor"`
-	}
+	var resp sessionResponse
 	if err := c.do(ctx, http.MethodPost, "/api/auth/login", payload, &resp); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
-			var errResp struct {
-				RequiresTwoFactor bool   `json:"requiresTwoFactor"`
-				Message           string `json:"message"`
-			}
-			if jsonErr := json.Unmarshal([]byte(httpErr.Body), &errResp); jsonErr == nil {
-				if errResp.RequiresTwoFactor {
-					return "", nil, errors.New("2FA code required. Please enter your TOTP code.")
-				}
-				return "", nil, errors.New(errResp.Message)
-			}
-		}
-		return "", nil, err
-	}
-	if !resp.Success {
-		return "", nil, errors.New(resp.Message)
+		return nil, err
 	}
-	return resp.Token, resp.User, nil
+	return resp.session(), nil
 }
 
-func (c *Client) Register(ctx context.Context, email, password, name string) (string, *User, error) {
+func (c *Client) Register(ctx context.Context, email, password, name string) (*Session, error) {
 	payload := map[string]string{"email": email, "password": password, "name": name}
-	var resp struct {
-		Success bool   `json:"success"`
-		Message string `json:"message"`
-		Token   string `json:"token"`
-		User    *User  `json:"user"`
-	}
+	var resp sessionResponse
 	if err := c.do(ctx, http.MethodPost, "/api/auth/register", payload, &resp); err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	if !resp.Success {
-		return "", nil, errors.New(resp.Message)
+	return resp.session(), nil
+}
+
+// Refresh exchanges a refresh token for a new session. Backends without
+// refresh support answer 404, surfaced as *NotFoundError.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Session, error) {
+	payload := map[string]string{"refreshToken": refreshToken}
+	var resp sessionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/auth/refresh", payload, &resp); err != nil {
+		return nil, err
+	}
+	sess := resp.session()
+	if sess.RefreshToken == "" {
+		// Backends that don't rotate refresh tokens keep the old one valid
+		sess.RefreshToken = refreshToken
 	}
-	return resp.Token, resp.User, nil
+	return sess, nil
 }
 
 func (c *Client) Me(ctx context.Context) (*User, error) {
@@ -154,9 +169,6 @@ func (c *Client) Me(ctx context.Context) (*User, error) {
 	if err := c.do(ctx, http.MethodGet, "/api/auth/me", nil, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.User, nil
 }
 
@@ -170,9 +182,6 @@ func (c *Client) ListFeeds(ctx context.Context) ([]Feed, error) {
 	if err := c.do(ctx, http.MethodGet, "/api/marketplace/feeds", nil, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -186,9 +195,6 @@ func (c *Client) MyFeeds(ctx context.Context) ([]Feed, error) {
 	if err := c.do(ctx, http.MethodGet, "/api/marketplace/my-feeds", nil, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -201,9 +207,6 @@ func (c *Client) Feed(ctx context.Context, id string) (*Feed, error) {
 	if err := c.do(ctx, http.MethodGet, "/api/marketplace/feeds/"+id, nil, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -216,9 +219,6 @@ func (c *Client) Subscriptions(ctx context.Context) ([]Subscription, error) {
 	if err := c.do(ctx, http.MethodGet, "/api/marketplace/subscriptions", nil, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -230,9 +230,6 @@ func (c *Client) Subscribe(ctx context.Context, feedID string) error {
 	if err := c.do(ctx, http.MethodPost, "/api/marketplace/subscribe/"+feedID, nil, &resp); err != nil {
 		return err
 	}
-	if !resp.Success {
-		return errors.New(resp.Message)
-	}
 	return nil
 }
 
@@ -244,9 +241,6 @@ func (c *Client) Unsubscribe(ctx context.Context, feedID string) error {
 	if err := c.do(ctx, http.MethodPost, "/api/marketplace/unsubscribe/"+feedID, nil, &resp); err != nil {
 		return err
 	}
-	if !resp.Success {
-		return errors.New(resp.Message)
-	}
 	return nil
 }
 
@@ -279,9 +273,6 @@ func (c *Client) CreateFeed(ctx context.Context, name, description, url, categor
 	if err := c.do(ctx, http.MethodPost, "/api/marketplace/feeds", payload, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -294,9 +285,6 @@ func (c *Client) UpdateFeed(ctx context.Context, feedID string, updates map[stri
 	if err := c.do(ctx, http.MethodPut, "/api/marketplace/feeds/"+feedID, updates, &resp); err != nil {
 		return nil, err
 	}
-	if !resp.Success {
-		return nil, errors.New(resp.Message)
-	}
 	return resp.Data, nil
 }
 
@@ -308,21 +296,51 @@ func (c *Client) DeleteFeed(ctx context.Context, feedID string) error {
 	if err := c.do(ctx, http.MethodDelete, "/api/marketplace/feeds/"+feedID, nil, &resp); err != nil {
 		return err
 	}
-	if !resp.Success {
-		return errors.New(resp.Message)
-	}
 	return nil
 }
 
-// do performs an HTTP request and unmarshals the response.
+// do performs an HTTP request and unmarshals the response. Failed attempts
+// are retried according to the client's RetryPolicy.
 func (c *Client) do(ctx context.Context, method, path string, payload interface{}, out interface{}) error {
-	var body io.Reader
+	var body []byte
 	if payload != nil {
 		buf := &bytes.Buffer{}
 		if err := json.NewEncoder(buf).Encode(payload); err != nil {
 			return err
 		}
-		body = buf
+		body = buf.Bytes()
+	}
+
+	attempts := c.retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.attempt(ctx, method, path, body, attempt-1, out)
+		if attempt >= attempts || !shouldRetry(method, err) {
+			return err
+		}
+
+		delay := c.retry.backoff(attempt)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > delay {
+			delay = httpErr.RetryAfter
+			if c.retry.MaxDelay > 0 && delay > c.retry.MaxDelay {
+				delay = c.retry.MaxDelay
+			}
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// attempt performs a single HTTP request; resend counts the attempts before it.
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, resend int, out interface{}) (err error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
@@ -335,7 +353,13 @@ func (c *Client) do(ctx context.Context, method, path string, payload interface{
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	var resp *http.Response
+	if c.tracer != nil {
+		finish := c.tracer.StartRequest(req, resend)
+		defer func() { finish(resp, err) }()
+	}
+
+	resp, err = c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -347,7 +371,14 @@ func (c *Client) do(ctx context.Context, method, path string, payload interface{
 	}
 
 	if resp.StatusCode >= 400 {
-		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+		return classifyError(resp.StatusCode, data, retryAfter(resp.Header))
+	}
+	// Some endpoints report failure as {"success": false} with a 2xx status
+	var result struct {
+		Success *bool `json:"success"`
+	}
+	if json.Unmarshal(data, &result) == nil && result.Success != nil && !*result.Success {
+		return classifyError(resp.StatusCode, data, 0)
 	}
 
 	if out != nil {
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrorBody is the decoded failure response shared by the typed API errors.
+// Inspect a specific kind with errors.As, e.g.
+//
+//	var verr *api.ValidationError
+//	if errors.As(err, &verr) { ... verr.Fields ... }
+type ErrorBody struct {
+	StatusCode int
+	Code       string // backend error code, if any
+	Message    string
+
+	http *HTTPError
+}
+
+func (e ErrorBody) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.http != nil {
+		return e.http.Error()
+	}
+	return fmt.Sprintf("request failed (%d)", e.StatusCode)
+}
+
+// Unwrap exposes the raw HTTPError (status, body, Retry-After).
+func (e ErrorBody) Unwrap() error {
+	if e.http == nil {
+		return nil
+	}
+	return e.http
+}
+
+type (
+	// AuthRequiredError means the token is missing, invalid or expired.
+	AuthRequiredError struct{ ErrorBody }
+	// TwoFactorRequiredError means the credentials were accepted but a TOTP code is needed.
+	TwoFactorRequiredError struct{ ErrorBody }
+	// ForbiddenError means the user may not perform the action.
+	ForbiddenError struct{ ErrorBody }
+	// NotFoundError means the resource does not exist.
+	NotFoundError struct{ ErrorBody }
+	// ValidationError means the request was rejected; Fields maps request
+	// fields (e.g. "url") to what is wrong with them.
+	ValidationError struct {
+		ErrorBody
+		Fields map[string]string
+	}
+	// RateLimitedError means too many requests; retry after RetryAfter.
+	RateLimitedError struct {
+		ErrorBody
+		RetryAfter time.Duration
+	}
+	// ServerError means the backend failed (5xx).
+	ServerError struct{ ErrorBody }
+	// RequestError is any other failure the backend reported.
+	RequestError struct{ ErrorBody }
+)
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.ErrorBody.Error()
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+e.Fields[name])
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = "validation failed"
+	}
+	return msg + " (" + strings.Join(parts, "; ") + ")"
+}
+
+// errorResponse is the shape of the backend's failure bodies. Field errors come
+// either as an object {"url": "invalid"} or a list [{"field": "url", "message": "invalid"}].
+type errorResponse struct {
+	Success           *bool           `json:"success"`
+	Message           string          `json:"message"`
+	Error             string          `json:"error"`
+	Code              string          `json:"code"`
+	RequiresTwoFactor bool            `json:"requiresTwoFactor"`
+	Errors            json.RawMessage `json:"errors"`
+}
+
+func (r errorResponse) fields() map[string]string {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	var byName map[string]string
+	if err := json.Unmarshal(r.Errors, &byName); err == nil {
+		return byName
+	}
+	var list []struct {
+		Field   string `json:"field"`
+		Param   string `json:"param"`
+		Message string `json:"message"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(r.Errors, &list); err != nil {
+		return nil
+	}
+	out := make(map[string]string, len(list))
+	for _, fe := range list {
+		name := fe.Field
+		if name == "" {
+			name = fe.Param
+		}
+		msg := fe.Message
+		if msg == "" {
+			msg = fe.Msg
+		}
+		if name != "" {
+			out[name] = msg
+		}
+	}
+	return out
+}
+
+// classifyError turns a failure response into a typed error. status is the
+// HTTP status, or 200 for a {"success": false} body on a 2xx response.
+func classifyError(status int, data []byte, retryAfter time.Duration) error {
+	var resp errorResponse
+	_ = json.Unmarshal(data, &resp)
+
+	body := ErrorBody{
+		StatusCode: status,
+		Code:       resp.Code,
+		Message:    resp.Message,
+	}
+	if body.Message == "" {
+		body.Message = resp.Error
+	}
+	if status >= 400 {
+		body.http = &HTTPError{StatusCode: status, Body: strings.TrimSpace(string(data)), RetryAfter: retryAfter}
+	}
+
+	fields := resp.fields()
+	switch {
+	case resp.RequiresTwoFactor:
+		return &TwoFactorRequiredError{body}
+	case status == http.StatusUnauthorized:
+		return &AuthRequiredError{body}
+	case status == http.StatusForbidden:
+		return &ForbiddenError{body}
+	case status == http.StatusNotFound:
+		return &NotFoundError{body}
+	case status == http.StatusTooManyRequests:
+		return &RateLimitedError{ErrorBody: body, RetryAfter: retryAfter}
+	case status >= 500:
+		return &ServerError{body}
+	case len(fields) > 0 || status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return &ValidationError{ErrorBody: body, Fields: fields}
+	}
+	return &RequestError{body}
+}
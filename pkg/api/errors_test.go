@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    error // zero value of the expected type
+		message string
+		fields  map[string]string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"message":"token expired"}`, &AuthRequiredError{}, "token expired", nil},
+		{"two factor", http.StatusUnauthorized, `{"requiresTwoFactor":true,"message":"code needed"}`, &TwoFactorRequiredError{}, "code needed", nil},
+		{"forbidden", http.StatusForbidden, `{"error":"not yours"}`, &ForbiddenError{}, "not yours", nil},
+		{"not found", http.StatusNotFound, ``, &NotFoundError{}, "", nil},
+		{"rate limited", http.StatusTooManyRequests, `{}`, &RateLimitedError{}, "", nil},
+		{"server error", http.StatusBadGateway, `<html>bad gateway</html>`, &ServerError{}, "", nil},
+		{"bad request", http.StatusBadRequest, `{"message":"bad"}`, &ValidationError{}, "bad", nil},
+		{"field object", http.StatusUnprocessableEntity, `{"errors":{"url":"invalid"}}`, &ValidationError{}, "",
+			map[string]string{"url": "invalid"}},
+		{"field list", http.StatusConflict, `{"errors":[{"field":"name","message":"taken"},{"param":"url","msg":"bad scheme"}]}`,
+			&ValidationError{}, "", map[string]string{"name": "taken", "url": "bad scheme"}},
+		{"success false", http.StatusOK, `{"success":false,"message":"nope"}`, &RequestError{}, "nope", nil},
+		{"other status", http.StatusConflict, `{"message":"exists"}`, &RequestError{}, "exists", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.status, []byte(tt.body), 0)
+			if reflect.TypeOf(err) != reflect.TypeOf(tt.want) {
+				t.Fatalf("classifyError = %T, want %T", err, tt.want)
+			}
+			body := reflect.ValueOf(err).Elem().FieldByName("ErrorBody").Interface().(ErrorBody)
+			if body.StatusCode != tt.status || body.Message != tt.message {
+				t.Errorf("body = {status %d, message %q}, want {%d, %q}", body.StatusCode, body.Message, tt.status, tt.message)
+			}
+			if tt.fields != nil {
+				var verr *ValidationError
+				if !errors.As(err, &verr) || !reflect.DeepEqual(verr.Fields, tt.fields) {
+					t.Errorf("fields = %v, want %v", verr.Fields, tt.fields)
+				}
+			}
+			var httpErr *HTTPError
+			if got := errors.As(err, &httpErr); got != (tt.status >= 400) {
+				t.Errorf("unwraps to HTTPError = %v for status %d", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorRetryAfter(t *testing.T) {
+	err := classifyError(http.StatusTooManyRequests, nil, 7*time.Second)
+	var limited *RateLimitedError
+	if !errors.As(err, &limited) || limited.RetryAfter != 7*time.Second {
+		t.Fatalf("classifyError = %#v, want RateLimitedError with RetryAfter 7s", err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.RetryAfter != 7*time.Second {
+		t.Errorf("HTTPError.RetryAfter = %v, want 7s", httpErr)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *ValidationError
+		want string
+	}{
+		{&ValidationError{ErrorBody: ErrorBody{Message: "bad feed"}}, "bad feed"},
+		{&ValidationError{ErrorBody: ErrorBody{Message: "bad feed"}, Fields: map[string]string{"url": "invalid", "name": "empty"}},
+			"bad feed (name: empty; url: invalid)"},
+		{&ValidationError{Fields: map[string]string{"url": "invalid"}}, "validation failed (url: invalid)"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	jwt := func(claims string) string {
+		return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  time.Time
+		ok    bool
+	}{
+		{"exp claim", jwt(`{"sub":"u1","exp":1700000000}`), time.Unix(1700000000, 0), true},
+		{"no exp", jwt(`{"sub":"u1"}`), time.Time{}, false},
+		{"zero exp", jwt(`{"exp":0}`), time.Time{}, false},
+		{"exp not a number", jwt(`{"exp":"soon"}`), time.Time{}, false},
+		{"payload not JSON", jwt(`not json`), time.Time{}, false},
+		{"padded payload", "a." + base64.URLEncoding.EncodeToString([]byte(`{"exp":12}`)) + ".c", time.Time{}, false},
+		{"two parts", "header.payload", time.Time{}, false},
+		{"empty", "", time.Time{}, false},
+		{"opaque token", "abc123", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TokenExpiry(tt.token)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("TokenExpiry = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Client.do retries failed requests.
+type RetryPolicy struct {
+	MaxAttempts  int           // total attempts including the first; 1 disables retries
+	InitialDelay time.Duration // delay before the first retry
+	MaxDelay     time.Duration // upper bound for backoff and Retry-After
+	Multiplier   float64       // growth factor applied per attempt
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: 250 * time.Millisecond,
+		MaxDelay:     5 * time.Second,
+		Multiplier:   2,
+	}
+}
+
+// SetRetryPolicy replaces the client's retry policy.
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// backoff returns the delay before retry n (1-based).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(n-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// idempotent reports whether repeating the method cannot change the outcome.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry decides whether a failed attempt may be repeated. Idempotent
+// requests retry on transport errors and gateway/overload statuses. Others
+// only retry when the server provably did not act on them: the connection was
+// never established, or the request was rejected with 429.
+func shouldRetry(method string, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent(method)
+		}
+		return false
+	}
+
+	// Only transport failures are retried; decoding errors would just repeat
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotent(method)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second}, // capped
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.retry); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.retry, got, tt.want)
+		}
+	}
+
+	uncapped := RetryPolicy{InitialDelay: time.Second, Multiplier: 3}
+	if got := uncapped.backoff(3); got != 9*time.Second {
+		t.Errorf("uncapped backoff(3) = %v, want 9s", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	status := func(code int) error { return &HTTPError{StatusCode: code} }
+	dialErr := &url.Error{Op: "Post", URL: "http://x", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+	readErr := &url.Error{Op: "Post", URL: "http://x", Err: &net.OpError{Op: "read", Err: errors.New("reset")}}
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		want   bool
+	}{
+		{"success", http.MethodGet, nil, false},
+		{"cancelled", http.MethodGet, context.Canceled, false},
+		{"deadline", http.MethodGet, fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{"429 on POST", http.MethodPost, status(http.StatusTooManyRequests), true},
+		{"503 on GET", http.MethodGet, status(http.StatusServiceUnavailable), true},
+		{"502 on PUT", http.MethodPut, status(http.StatusBadGateway), true},
+		{"504 on DELETE", http.MethodDelete, status(http.StatusGatewayTimeout), true},
+		{"503 on POST", http.MethodPost, status(http.StatusServiceUnavailable), false},
+		{"500 on GET", http.MethodGet, status(http.StatusInternalServerError), false},
+		{"404 on GET", http.MethodGet, status(http.StatusNotFound), false},
+		{"classified 429 on POST", http.MethodPost, classifyError(http.StatusTooManyRequests, nil, 0), true},
+		{"classified 503 on GET", http.MethodGet, classifyError(http.StatusServiceUnavailable, nil, 0), true},
+		{"dial failure on POST", http.MethodPost, dialErr, true},
+		{"read failure on GET", http.MethodGet, readErr, true},
+		{"read failure on POST", http.MethodPost, readErr, false},
+		{"decode error", http.MethodGet, errors.New("invalid character"), false},
+		// Only errors from the round trip itself count as transport failures
+		{"read failure while decoding a GET body", http.MethodGet, &net.OpError{Op: "read", Err: errors.New("reset")}, false},
+		{"wrapped dial failure on POST", http.MethodPost, fmt.Errorf("create feed: %w", dialErr), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetry(tt.method, tt.err); got != tt.want {
+				t.Errorf("shouldRetry(%s, %v) = %v, want %v", tt.method, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"absent", "", 0, 0},
+		{"seconds", "3", 3 * time.Second, 3 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"garbage", "soon", 0, 0},
+		{"future date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 55 * time.Second, time.Minute},
+		{"past date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.value != "" {
+				h.Set("Retry-After", tt.value)
+			}
+			if got := retryAfter(h); got < tt.min || got > tt.max {
+				t.Errorf("retryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
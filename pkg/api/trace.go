@@ -0,0 +1,18 @@
+package api
+
+import "net/http"
+
+// Tracer is told about every HTTP request the client sends, e.g. to record
+// it as a span and propagate the trace context to the backend.
+type Tracer interface {
+	// StartRequest is called before req is sent and may add headers to it.
+	// resend counts the earlier attempts of the same call. The returned func
+	// is called once with the response (nil if none arrived) and the
+	// attempt's error.
+	StartRequest(req *http.Request, resend int) func(resp *http.Response, err error)
+}
+
+// SetTracer reports every request to t; nil stops tracing.
+func (c *Client) SetTracer(t Tracer) {
+	c.tracer = t
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TransportConfig describes how connections to the backend are made. The same
+// transport is shared by REST calls and the WebSocket handshake so proxies and
+// TLS settings apply to both.
+type TransportConfig struct {
+	CAFile             string // PEM bundle trusted in addition to the system roots
+	CertFile           string // client certificate for mutual TLS
+	KeyFile            string // private key for CertFile
+	InsecureSkipVerify bool   // local development only
+}
+
+// NewTransport builds an HTTP transport from cfg. Proxies come from the
+// environment (HTTPS_PROXY, HTTP_PROXY, NO_PROXY).
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s contains no certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert writes a self-signed certificate and its key as PEM files.
+func testCert(t *testing.T, dir, name string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	return certFile, keyFile, cert
+}
+
+func TestNewTransport(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := testCert(t, dir, "client")
+	_, otherKey, _ := testCert(t, dir, "other")
+	noCerts := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(noCerts, []byte("not a certificate\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       TransportConfig
+		wantErr   bool
+		wantRoots bool
+		wantCerts int
+	}{
+		{"defaults", TransportConfig{}, false, false, 0},
+		{"CA bundle", TransportConfig{CAFile: certFile}, false, true, 0},
+		{"missing CA bundle", TransportConfig{CAFile: filepath.Join(dir, "missing.pem")}, true, false, 0},
+		{"CA bundle without certificates", TransportConfig{CAFile: noCerts}, true, false, 0},
+		{"client certificate", TransportConfig{CertFile: certFile, KeyFile: keyFile}, false, false, 1},
+		{"certificate without key", TransportConfig{CertFile: certFile}, true, false, 0},
+		{"key without certificate", TransportConfig{KeyFile: keyFile}, true, false, 0},
+		{"key of another certificate", TransportConfig{CertFile: certFile, KeyFile: otherKey}, true, false, 0},
+		{"key file is not a key", TransportConfig{CertFile: certFile, KeyFile: noCerts}, true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := NewTransport(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTransport error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			tlsConfig := tr.TLSClientConfig
+			if tlsConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", tlsConfig.MinVersion)
+			}
+			if (tlsConfig.RootCAs != nil) != tt.wantRoots {
+				t.Errorf("RootCAs set = %v, want %v", tlsConfig.RootCAs != nil, tt.wantRoots)
+			}
+			if len(tlsConfig.Certificates) != tt.wantCerts {
+				t.Errorf("%d client certificates, want %d", len(tlsConfig.Certificates), tt.wantCerts)
+			}
+			if tr.Proxy == nil {
+				t.Error("proxy settings from the environment are ignored")
+			}
+		})
+	}
+}
+
+func TestNewTransportMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey, _ := testCert(t, dir, "server")
+	clientCert, clientKey, clientX509 := testCert(t, dir, "client")
+
+	pair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := x509.NewCertPool()
+	clients.AddCert(clientX509)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		cfg     TransportConfig
+		wantErr bool
+	}{
+		{"trusted CA and client certificate", TransportConfig{CAFile: serverCert, CertFile: clientCert, KeyFile: clientKey}, false},
+		{"no client certificate", TransportConfig{CAFile: serverCert}, true},
+		{"server not trusted", TransportConfig{CertFile: clientCert, KeyFile: clientKey}, true},
+		{"verification skipped", TransportConfig{InsecureSkipVerify: true, CertFile: clientCert, KeyFile: clientKey}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := NewTransport(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tr.CloseIdleConnections()
+			resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get(srv.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GET error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		})
+	}
+}
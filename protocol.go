@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// envelopeHandler decodes the payload of one envelope type and returns the
+// message to deliver to the UI. A nil message means the envelope was fully
+// handled by the client (or needs no UI update).
+type envelopeHandler func(c *wsClient, payload json.RawMessage) (tea.Msg, error)
+
+var envelopeHandlers = map[string]envelopeHandler{}
+
+// registerEnvelope adds a handler for an envelope type. New backend events
+// only need a registration here; the read loop dispatches by type.
+func registerEnvelope(envType string, h envelopeHandler) {
+	envelopeHandlers[envType] = h
+}
+
+// decodeInto adapts a typed payload constructor into an envelopeHandler.
+func decodeInto[T any](build func(c *wsClient, payload T) tea.Msg) envelopeHandler {
+	return func(c *wsClient, raw json.RawMessage) (tea.Msg, error) {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, err
+		}
+		return build(c, payload), nil
+	}
+}
+
+type (
+	feedDataPayload struct {
+		FeedID    string          `json:"feedId"`
+		FeedName  string          `json:"feedName"`
+		EventName string          `json:"eventName"`
+		Data      json.RawMessage `json:"data"`
+		Timestamp string          `json:"timestamp"`
+		Seq       int64           `json:"seq"`
+	}
+	feedGapPayload struct {
+		FeedID  string `json:"feedId"`
+		FromSeq int64  `json:"fromSeq"`
+		ToSeq   int64  `json:"toSeq"`
+		From    string `json:"from"`
+		To      string `json:"to"`
+	}
+	llmAnswerPayload struct {
+		RequestID  string           `json:"requestId"`
+		Answer     string           `json:"answer"`
+		Provider   string           `json:"provider"`
+		Model      string           `json:"model"`
+		DurationMs int64            `json:"durationMs"`
+		Usage      *llmUsagePayload `json:"usage"`
+	}
+	// llmUsagePayload accepts the backend's own fields as well as the usage
+	// object of the OpenAI or Anthropic API passed through unchanged.
+	llmUsagePayload struct {
+		PromptTokens     int    `json:"promptTokens"`
+		CompletionTokens int    `json:"completionTokens"`
+		CachedTokens     int    `json:"cachedTokens"`
+		Model            string `json:"model"`
+		// OpenAI
+		OpenAIPrompt     int `json:"prompt_tokens"`
+		OpenAICompletion int `json:"completion_tokens"`
+		OpenAIDetails    struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+		// Anthropic; input_tokens leaves out the cached part of the prompt
+		AnthropicInput      int `json:"input_tokens"`
+		AnthropicOutput     int `json:"output_tokens"`
+		AnthropicCacheRead  int `json:"cache_read_input_tokens"`
+		AnthropicCacheWrite int `json:"cache_creation_input_tokens"`
+	}
+	llmTokenPayload struct {
+		RequestID string `json:"requestId"`
+		Token     string `json:"token"`
+	}
+	llmBroadcastPayload struct {
+		FeedID    string `json:"feedId"`
+		Answer    string `json:"answer"`
+		Provider  string `json:"provider"`
+		Timestamp string `json:"timestamp"`
+	}
+	llmCancelledPayload struct {
+		RequestID string `json:"requestId"`
+	}
+	subscriptionAckPayload struct {
+		FeedID    string `json:"feedId"`
+		RequestID string `json:"requestId"`
+		Error     string `json:"error"`
+	}
+	authErrorPayload struct {
+		Error string `json:"error"`
+	}
+	llmErrorPayload struct {
+		RequestID string `json:"requestId"`
+		Error     string `json:"error"`
+	}
+)
+
+func init() {
+	registerEnvelope("registration-success", func(c *wsClient, _ json.RawMessage) (tea.Msg, error) {
+		return wsStatusMsg{Status: "connected", Err: nil}, nil
+	})
+	registerEnvelope("auth-error", decodeInto(func(c *wsClient, p authErrorPayload) tea.Msg {
+		// Token expired or was revoked; the supervisor reports it once the socket closes
+		if conn := c.currentConn(); conn != nil {
+			c.abortAsync(conn, fmt.Errorf("%w: %s", errWSAuth, p.Error), "auth failed")
+		}
+		return nil
+	}))
+	registerEnvelope("feed-data", handleFeedData)
+	registerEnvelope("feed-gap", decodeInto(func(c *wsClient, p feedGapPayload) tea.Msg {
+		// The backend could not replay part of the outage.
+		from, _ := time.Parse(time.RFC3339, p.From)
+		to, _ := time.Parse(time.RFC3339, p.To)
+		gap := feedGapMsg{FeedID: p.FeedID, From: from, To: to}
+		if p.ToSeq >= p.FromSeq && p.FromSeq > 0 {
+			gap.Missed = p.ToSeq - p.FromSeq + 1
+		}
+		// Skip past the lost range so the next event isn't counted twice
+		c.skipCursor(p.FeedID, p.ToSeq, to)
+		return gap
+	}))
+	registerEnvelope("token-usage-update", decodeInto(func(c *wsClient, usage api.TokenUsage) tea.Msg {
+		return tokenUsageUpdateMsg{Usage: &usage}
+	}))
+	registerEnvelope("subscription-success", subscriptionAck("subscribe", false))
+	registerEnvelope("subscription-error", subscriptionAck("subscribe", true))
+	registerEnvelope("unsubscription-success", subscriptionAck("unsubscribe", false))
+	registerEnvelope("unsubscription-error", subscriptionAck("unsubscribe", true))
+	llmAnswer := decodeInto(func(c *wsClient, p llmAnswerPayload) tea.Msg {
+		model := p.Model
+		if model == "" && p.Usage != nil {
+			model = p.Usage.Model
+		}
+		return aiResponseMsg{
+			RequestID: p.RequestID,
+			Answer:    p.Answer,
+			Provider:  p.Provider,
+			Model:     model,
+			Duration:  p.DurationMs,
+			Usage:     p.Usage.usage(model),
+		}
+	})
+	registerEnvelope("llm-response", llmAnswer)
+	registerEnvelope("llm-complete", llmAnswer)
+	registerEnvelope("llm-token", decodeInto(func(c *wsClient, p llmTokenPayload) tea.Msg {
+		return aiTokenMsg{RequestID: p.RequestID, Token: p.Token}
+	}))
+	registerEnvelope("llm-broadcast", decodeInto(func(c *wsClient, p llmBroadcastPayload) tea.Msg {
+		ts, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil {
+			ts = time.Now()
+		}
+		return aiBroadcastMsg{FeedID: p.FeedID, Answer: p.Answer, Provider: p.Provider, Time: ts}
+	}))
+	registerEnvelope("llm-cancelled", decodeInto(func(c *wsClient, p llmCancelledPayload) tea.Msg {
+		return aiCancelledMsg{RequestID: p.RequestID}
+	}))
+	registerEnvelope("llm-error", decodeInto(func(c *wsClient, p llmErrorPayload) tea.Msg {
+		return aiResponseMsg{RequestID: p.RequestID, Err: errors.New(p.Error)}
+	}))
+}
+
+// subscriptionAck resolves the outbox command a (un)subscription envelope answers.
+func subscriptionAck(action string, failed bool) envelopeHandler {
+	return decodeInto(func(c *wsClient, p subscriptionAckPayload) tea.Msg {
+		errText := ""
+		if failed {
+			errText = p.Error
+			if errText == "" {
+				errText = action + " rejected by backend"
+			}
+		}
+		return c.acknowledge(p.RequestID, action, p.FeedID, errText)
+	})
+}
+
+// usage normalizes the reported counts; nil when the backend sent none.
+func (p *llmUsagePayload) usage(model string) *llmUsage {
+	if p == nil {
+		return nil
+	}
+	u := &llmUsage{
+		PromptTokens:     firstNonZero(p.PromptTokens, p.OpenAIPrompt, p.AnthropicInput+p.AnthropicCacheRead+p.AnthropicCacheWrite),
+		CompletionTokens: firstNonZero(p.CompletionTokens, p.OpenAICompletion, p.AnthropicOutput),
+		CachedTokens:     firstNonZero(p.CachedTokens, p.OpenAIDetails.CachedTokens, p.AnthropicCacheRead),
+		Model:            model,
+	}
+	if u.PromptTokens == 0 && u.CompletionTokens == 0 {
+		return nil
+	}
+	return u
+}
+
+func firstNonZero(values ...int) int {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// handleFeedData hands feed events to the ingestor instead of the UI channel.
+func handleFeedData(c *wsClient, raw json.RawMessage) (tea.Msg, error) {
+	var payload feedDataPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		// Report packet dropped due to parse error
+		return packetDroppedMsg{FeedID: payload.FeedID, Reason: "json_parse_error"}, err
+	}
+	ts, _ := time.Parse(time.RFC3339, payload.Timestamp)
+	if !c.advanceCursor(payload.FeedID, payload.Seq, ts) {
+		// Replayed event we already delivered before the reconnect
+		return nil, nil
+	}
+	c.ingest.Push(feedDataMsg{
+		FeedID:    payload.FeedID,
+		FeedName:  payload.FeedName,
+		EventName: payload.EventName,
+		Data:      string(payload.Data),
+		Time:      ts,
+		Seq:       payload.Seq,
+	})
+	return nil, nil
+}
+
+// protocolRecord is an envelope the client could not handle.
+type protocolRecord struct {
+	Time   time.Time
+	Type   string
+	Reason string
+	Raw    string
+}
+
+// protocolCounter tracks envelopes seen for one type.
+type protocolCounter struct {
+	Type     string
+	Received uint64
+	Errors   uint64
+	Unknown  bool
+}
+
+// protocolInspector keeps per-type counters and the most recent unknown or
+// undecodable envelopes for the Protocol tab. It is shared with the ws client.
+type protocolInspector struct {
+	mu       sync.RWMutex
+	counters map[string]*protocolCounter
+	records  []protocolRecord
+	maxSize  int
+}
+
+func newProtocolInspector(maxRecords int) *protocolInspector {
+	return &protocolInspector{
+		counters: make(map[string]*protocolCounter),
+		records:  make([]protocolRecord, 0, maxRecords),
+		maxSize:  maxRecords,
+	}
+}
+
+func (p *protocolInspector) counter(envType string) *protocolCounter {
+	ctr, ok := p.counters[envType]
+	if !ok {
+		ctr = &protocolCounter{Type: envType}
+		p.counters[envType] = ctr
+	}
+	return ctr
+}
+
+// RecordHandled counts a successfully decoded envelope.
+func (p *protocolInspector) RecordHandled(envType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counter(envType).Received++
+}
+
+// RecordIssue counts an envelope that was unknown or failed to decode and
+// keeps its raw JSON for inspection.
+func (p *protocolInspector) RecordIssue(envType, reason string, raw []byte, unknown bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ctr := p.counter(envType)
+	ctr.Received++
+	ctr.Errors++
+	ctr.Unknown = unknown
+
+	p.records = append(p.records, protocolRecord{
+		Time:   time.Now(),
+		Type:   envType,
+		Reason: reason,
+		Raw:    string(raw),
+	})
+	if len(p.records) > p.maxSize {
+		p.records = p.records[len(p.records)-p.maxSize:]
+	}
+}
+
+// Snapshot returns counters sorted by type and records newest first.
+func (p *protocolInspector) Snapshot() ([]protocolCounter, []protocolRecord) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	counters := make([]protocolCounter, 0, len(p.counters))
+	for _, ctr := range p.counters {
+		counters = append(counters, *ctr)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Type < counters[j].Type
+	})
+
+	records := make([]protocolRecord, len(p.records))
+	for i, r := range p.records {
+		records[len(p.records)-1-i] = r
+	}
+	return counters, records
+}
+
+// Len is the number of recorded envelopes.
+func (p *protocolInspector) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.records)
+}
+
+// Clear drops the recorded envelopes but keeps the counters.
+func (p *protocolInspector) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = p.records[:0]
+}
+
+// Reset drops the records and the counters, e.g. when switching backends.
+func (p *protocolInspector) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = p.records[:0]
+	p.counters = make(map[string]*protocolCounter)
+}
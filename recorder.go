@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// sessionRecord is one line of a session file. Envelopes are stored exactly
+// as decoded from the socket; the REST snapshots and pongs are what the
+// dashboard needs besides envelopes to look the same on replay.
+type sessionRecord struct {
+	Time time.Time `json:"t"`
+	Kind string    `json:"kind"` // "session", "envelope", "pong", "query", "cancel", "user", "feeds" or "subs"
+
+	Envelope json.RawMessage `json:"env,omitempty"`
+	Wire     int             `json:"wire,omitempty"` // frame size on the wire
+	Size     int             `json:"size,omitempty"` // frame size after inflation
+
+	RTTMicros int64 `json:"rttUs,omitempty"`
+
+	// LLM requests we sent, so replayed answers find their feed
+	RequestID string `json:"requestId,omitempty"`
+	FeedID    string `json:"feedId,omitempty"`
+	Prompt    string `json:"prompt,omitempty"`
+
+	Backend string             `json:"backend,omitempty"`
+	User    *api.User          `json:"user,omitempty"`
+	Feeds   []api.Feed         `json:"feeds,omitempty"`
+	Subs    []api.Subscription `json:"subs,omitempty"`
+}
+
+// sessionRecorder writes a gzip-compressed NDJSON session file. All methods
+// are safe on a nil recorder so call sites don't need to check.
+type sessionRecorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	dirty  bool // records written since the last flush
+	closed bool
+	err    error // first write error; recording stops after it
+	done   chan struct{}
+}
+
+// recorderFlushInterval bounds how much is lost if the process dies mid-session.
+const recorderFlushInterval = time.Second
+
+func newSessionRecorder(path, backendURL string) (*sessionRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	buf := bufio.NewWriter(gz)
+	r := &sessionRecorder{file: file, gz: gz, buf: buf, enc: json.NewEncoder(buf), done: make(chan struct{})}
+	r.write(sessionRecord{Kind: "session", Backend: backendURL})
+	if r.err != nil {
+		file.Close()
+		return nil, r.err
+	}
+	go r.runFlusher()
+	return r, nil
+}
+
+// runFlusher flushes on a ticker, so the tail of an idle session reaches the
+// file without waiting for another record.
+func (r *sessionRecorder) runFlusher() {
+	ticker := time.NewTicker(recorderFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.dirty && r.err == nil && !r.closed {
+				r.flushLocked()
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *sessionRecorder) write(rec sessionRecord) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.closed {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if err := r.enc.Encode(rec); err != nil {
+		r.err = err
+		return
+	}
+	r.dirty = true
+}
+
+func (r *sessionRecorder) flushLocked() {
+	if err := r.buf.Flush(); err != nil {
+		r.err = err
+		return
+	}
+	if err := r.gz.Flush(); err != nil {
+		r.err = err
+	}
+	r.dirty = false
+}
+
+// Envelope records a decoded envelope and the size of the frame it came in.
+func (r *sessionRecorder) Envelope(raw json.RawMessage, frame frameSize) {
+	r.write(sessionRecord{Kind: "envelope", Envelope: raw, Wire: frame.Wire, Size: frame.Decoded})
+}
+
+// Pong records a heartbeat round trip.
+func (r *sessionRecorder) Pong(rtt time.Duration) {
+	r.write(sessionRecord{Kind: "pong", RTTMicros: rtt.Microseconds()})
+}
+
+// Query records an LLM query sent for a feed.
+func (r *sessionRecorder) Query(requestID, feedID, prompt string) {
+	r.write(sessionRecord{Kind: "query", RequestID: requestID, FeedID: feedID, Prompt: prompt})
+}
+
+// Cancel records a cancelled LLM query.
+func (r *sessionRecorder) Cancel(requestID string) {
+	r.write(sessionRecord{Kind: "cancel", RequestID: requestID})
+}
+
+func (r *sessionRecorder) User(user *api.User) {
+	r.write(sessionRecord{Kind: "user", User: user})
+}
+
+func (r *sessionRecorder) Feeds(feeds []api.Feed) {
+	r.write(sessionRecord{Kind: "feeds", Feeds: feeds})
+}
+
+func (r *sessionRecorder) Subs(subs []api.Subscription) {
+	r.write(sessionRecord{Kind: "subs", Subs: subs})
+}
+
+// Err reports why recording stopped, if it did.
+func (r *sessionRecorder) Err() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close flushes and finishes the gzip stream.
+func (r *sessionRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	r.flushLocked()
+	if err := r.gz.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if r.err != nil {
+		return fmt.Errorf("session recording: %w", r.err)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// replaySpeeds are the playback rates cycled with < and >; 0 means as fast as possible.
+var replaySpeeds = []float64{1, 2, 10, 0}
+
+func parseReplaySpeed(s string) (float64, error) {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "x")
+	if s == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(s, 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q (want 1, 2, 10 or max)", s)
+	}
+	return speed, nil
+}
+
+func formatReplaySpeed(speed float64) string {
+	if speed == 0 {
+		return "max"
+	}
+	return strconv.FormatFloat(speed, 'f', -1, 64) + "x"
+}
+
+// replayClock is the recording's notion of "now": the timestamp of the last
+// replayed record, advanced by wall time scaled by the playback speed.
+type replayClock struct {
+	mu     sync.Mutex
+	at     time.Time // recorded time at the anchor
+	wall   time.Time // wall time at the anchor
+	speed  float64   // 0 = max: time only moves with the records
+	paused bool
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *replayClock) nowLocked() time.Time {
+	if c.paused || c.speed == 0 {
+		return c.at
+	}
+	return c.at.Add(time.Duration(float64(time.Since(c.wall)) * c.speed))
+}
+
+// set anchors the clock at a recorded time.
+func (c *replayClock) set(at time.Time) {
+	c.mu.Lock()
+	c.at, c.wall = at, time.Now()
+	c.mu.Unlock()
+}
+
+func (c *replayClock) setSpeed(speed float64) {
+	c.mu.Lock()
+	c.at, c.wall = c.nowLocked(), time.Now()
+	c.speed = speed
+	c.mu.Unlock()
+}
+
+func (c *replayClock) togglePause() {
+	c.mu.Lock()
+	c.at, c.wall = c.nowLocked(), time.Now()
+	c.paused = !c.paused
+	c.mu.Unlock()
+}
+
+// until returns how long to wait on the wall clock before the recorded time
+// t is due, and false while paused.
+func (c *replayClock) until(t time.Time) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return 0, false
+	}
+	if c.speed == 0 {
+		return 0, true
+	}
+	return time.Duration(float64(t.Sub(c.nowLocked())) / c.speed), true
+}
+
+func (c *replayClock) state() (speed float64, paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.speed, c.paused
+}
+
+// replayControl is a key press forwarded to the playback goroutine.
+type replayControl struct {
+	pause bool          // toggle pause
+	speed int           // +1 faster, -1 slower
+	seek  time.Duration // relative jump in recorded time
+}
+
+var replayKeys = map[string]replayControl{
+	" ": {pause: true},
+	">": {speed: 1},
+	"<": {speed: -1},
+	"]": {seek: 10 * time.Second},
+	"[": {seek: -10 * time.Second},
+	"}": {seek: time.Minute},
+	"{": {seek: -time.Minute},
+}
+
+// replayer plays a session file through a wsClient that has no socket, so
+// envelopes take the same dispatch path, ingestor and metrics as live ones.
+type replayer struct {
+	path    string
+	backend string
+	user    *api.User
+	start   time.Time // first record
+	end     time.Time // last record
+
+	client   *wsClient
+	clock    *replayClock
+	ctrl     chan replayControl
+	finished atomic.Bool
+}
+
+// openReplay scans a session file for its time range and header.
+func openReplay(path string, speed float64) (*replayer, error) {
+	r := &replayer{path: path, clock: &replayClock{speed: speed}, ctrl: make(chan replayControl, 8)}
+	err := r.scan(func(rec sessionRecord) error {
+		if r.start.IsZero() {
+			r.start = rec.Time
+		}
+		r.end = rec.Time
+		switch rec.Kind {
+		case "session":
+			r.backend = rec.Backend
+		case "user":
+			if r.user == nil {
+				r.user = rec.User
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.start.IsZero() {
+		return nil, fmt.Errorf("%s: no records", path)
+	}
+	r.clock.set(r.start)
+	return r, nil
+}
+
+var errReplayRestart = errors.New("replay restart")
+
+// scan decodes every record in order. A truncated file (the recorder was
+// killed) ends the scan instead of failing it.
+func (r *replayer) scan(fn func(sessionRecord) error) error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+	dec := json.NewDecoder(gz)
+	for {
+		var rec sessionRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.path, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// Start plays the file on client until it is closed.
+func (r *replayer) Start(client *wsClient) {
+	client.replaying = true
+	r.client = client
+	go r.run()
+}
+
+func (r *replayer) run() {
+	c := r.client
+	defer close(c.incoming)
+
+	var skipTo time.Time
+	for {
+		restartAt := time.Time{}
+		err := r.scan(func(rec sessionRecord) error {
+			if !skipTo.IsZero() {
+				if rec.Time.Before(skipTo) {
+					// Seeking: apply without delay so state matches the target time
+					r.fastForward(rec)
+					return nil
+				}
+				r.clock.set(skipTo)
+				skipTo = time.Time{}
+			}
+			target, err := r.waitFor(rec.Time)
+			if err != nil {
+				restartAt = target
+				return err
+			}
+			if !target.IsZero() {
+				// Forward seek: the remaining records up to target are skipped through
+				skipTo = target
+				if rec.Time.Before(skipTo) {
+					r.fastForward(rec)
+					return nil
+				}
+				r.clock.set(skipTo)
+				skipTo = time.Time{}
+			}
+			r.clock.set(rec.Time)
+			r.apply(rec)
+			return nil
+		})
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, errReplayRestart) {
+			c.emit(wsStatusMsg{Status: "disconnected", Err: err})
+			return
+		}
+		if restartAt.IsZero() {
+			r.finished.Store(true)
+			c.emit(replayEndMsg{})
+			var ok bool
+			if restartAt, ok = r.waitAtEnd(); !ok {
+				return
+			}
+			r.finished.Store(false)
+		}
+		r.reset()
+		skipTo = restartAt
+	}
+}
+
+// waitFor blocks until the record at t is due, handling controls meanwhile.
+// A forward seek returns its target; a backward seek returns its target with
+// errReplayRestart.
+func (r *replayer) waitFor(t time.Time) (time.Time, error) {
+	for {
+		wait, playing := r.clock.until(t)
+		if playing && wait <= 0 {
+			r.throttle()
+			return time.Time{}, nil
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if playing {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-r.client.ctx.Done():
+			return time.Time{}, r.client.ctx.Err()
+		case <-due:
+			return time.Time{}, nil
+		case ctl := <-r.ctrl:
+			if timer != nil {
+				timer.Stop()
+			}
+			if target, seeking := r.control(ctl); seeking {
+				if target.Before(r.clock.Now()) {
+					return target, errReplayRestart
+				}
+				return target, nil
+			}
+		}
+	}
+}
+
+// waitAtEnd keeps handling controls after the last record; only a backward
+// seek restarts playback.
+func (r *replayer) waitAtEnd() (time.Time, bool) {
+	for {
+		select {
+		case <-r.client.ctx.Done():
+			return time.Time{}, false
+		case ctl := <-r.ctrl:
+			if target, seeking := r.control(ctl); seeking && target.Before(r.clock.Now()) {
+				return target, true
+			}
+		}
+	}
+}
+
+// control applies pause and speed changes and returns the target of a seek.
+func (r *replayer) control(ctl replayControl) (time.Time, bool) {
+	if ctl.pause {
+		r.clock.togglePause()
+	}
+	if ctl.speed != 0 {
+		speed, _ := r.clock.state()
+		idx := 0
+		for i, s := range replaySpeeds {
+			if s == speed {
+				idx = i
+			}
+		}
+		idx += ctl.speed
+		if idx >= 0 && idx < len(replaySpeeds) {
+			r.clock.setSpeed(replaySpeeds[idx])
+		}
+	}
+	if ctl.seek == 0 {
+		return time.Time{}, false
+	}
+	target := r.clock.Now().Add(ctl.seek)
+	if target.Before(r.start) {
+		target = r.start
+	}
+	if target.After(r.end) {
+		target = r.end
+	}
+	return target, true
+}
+
+// throttle keeps fast playback from overflowing the ingest buffers, which
+// would show up as packet loss that never happened live.
+func (r *replayer) throttle() {
+	in := r.client.ingest
+	for in.Backlog() >= in.cfg.BufferSize/2 {
+		select {
+		case <-r.client.ctx.Done():
+			return
+		case <-time.After(in.cfg.FrameInterval / 4):
+		}
+	}
+}
+
+// fastForward applies a record passed over by a seek. It skips the wait but
+// not the throttle, so a seek can't flood the ingest rings either.
+func (r *replayer) fastForward(rec sessionRecord) {
+	r.throttle()
+	r.clock.set(rec.Time)
+	r.apply(rec)
+}
+
+// apply delivers one record as the live client would have.
+func (r *replayer) apply(rec sessionRecord) {
+	c := r.client
+	switch rec.Kind {
+	case "envelope":
+		c.ingest.metrics.RecordConnectionBytes(backendConnection, rec.Wire, rec.Size)
+		c.dispatch(rec.Envelope)
+	case "pong":
+		c.emit(wsHeartbeatMsg{RTT: time.Duration(rec.RTTMicros) * time.Microsecond, At: rec.Time})
+	case "query":
+		c.emit(replayQueryMsg{RequestID: rec.RequestID, FeedID: rec.FeedID, Prompt: rec.Prompt})
+	case "cancel":
+		c.emit(replayCancelMsg{RequestID: rec.RequestID})
+	case "feeds":
+		c.emit(replayedMsg{Msg: feedsMsg{Feeds: rec.Feeds}})
+	case "subs":
+		c.emit(replayedMsg{Msg: subsMsg{Subs: rec.Subs}})
+	}
+}
+
+// reset returns the client, ingestor and metrics to their state before the
+// first record and waits until the UI has cleared its own.
+func (r *replayer) reset() {
+	c := r.client
+	c.cursorMu.Lock()
+	c.cursors = map[string]feedCursor{}
+	c.cursorMu.Unlock()
+	c.ingest.Reset()
+	c.ingest.metrics.Reset()
+	r.clock.set(r.start)
+
+	done := make(chan struct{})
+	c.emit(replayResetMsg{Done: done})
+	select {
+	case <-done:
+	case <-c.ctx.Done():
+	}
+}
+
+// Control forwards a key press to the playback goroutine without blocking the UI.
+func (r *replayer) Control(ctl replayControl) {
+	select {
+	case r.ctrl <- ctl:
+	default:
+	}
+}
+
+// Status describes the playback position for the top bar.
+func (r *replayer) Status() string {
+	total := r.end.Sub(r.start)
+	pos := r.clock.Now().Sub(r.start)
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > total {
+		pos = total
+	}
+	speed, paused := r.clock.state()
+	state := formatReplaySpeed(speed)
+	switch {
+	case r.finished.Load():
+		state = "finished"
+	case paused:
+		state += " paused"
+	}
+	return fmt.Sprintf("%s / %s %s", formatClock(pos), formatClock(total), state)
+}
+
+// formatClock renders a duration as m:ss or h:mm:ss.
+func formatClock(d time.Duration) string {
+	secs := int(d.Seconds())
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
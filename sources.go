@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sseTransport reads a Server-Sent Events stream. The event field names the
+// event unless an event path is configured, and the last event ID is sent
+// back on reconnect so the server can resume.
+type sseTransport struct {
+	url    string
+	client *http.Client
+	lastID string
+}
+
+func (t *sseTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if t.lastID != "" {
+		req.Header.Set("Last-Event-ID", t.lastID)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	connected()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), localReadLimit)
+	var event string
+	var data bytes.Buffer
+	hasData := false
+	wire := 0 // bytes of the event's lines; the body is read ahead, so the connection count lags
+	for scanner.Scan() {
+		line := scanner.Text()
+		wire += len(line) + 1
+		if line == "" {
+			// A blank line dispatches the event collected so far
+			if hasData {
+				deliver(sourceMessage{
+					Data:  append([]byte(nil), data.Bytes()...),
+					Event: event,
+					Frame: frameSize{Wire: wire, Decoded: data.Len()},
+				})
+			}
+			event, hasData, wire = "", false, 0
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, often a keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				t.lastID = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by server")
+}
+
+// pollTransport requests a URL on an interval. With a data path every match
+// in the JSON response is one message; without one the whole body is.
+type pollTransport struct {
+	url       string
+	interval  time.Duration
+	dataPath  string
+	client    *http.Client
+	wireBytes *atomic.Int64
+	etag      string
+}
+
+func (t *pollTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	ok := false
+	for {
+		if err := t.poll(ctx, deliver); err != nil {
+			return err
+		}
+		if !ok {
+			ok = true
+			connected()
+		}
+		timer := time.NewTimer(t.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *pollTransport) poll(ctx context.Context, deliver func(sourceMessage)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if t.etag != "" {
+		req.Header.Set("If-None-Match", t.etag)
+	}
+	before := t.wireBytes.Load()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, localReadLimit+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > localReadLimit {
+		deliver(sourceMessage{Dropped: "oversized_response"})
+		return nil
+	}
+	t.etag = resp.Header.Get("ETag")
+	wire := int(t.wireBytes.Load() - before)
+
+	body = bytes.TrimSpace(body)
+	if t.dataPath == "" {
+		if len(body) > 0 {
+			deliver(sourceMessage{Data: body, Frame: frameSize{Wire: wire, Decoded: len(body)}})
+		}
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		deliver(sourceMessage{Dropped: "invalid_json"})
+		return nil
+	}
+	matches, _ := evalJSONPath(doc, t.dataPath)
+	for _, match := range matches {
+		data, err := json.Marshal(match)
+		if err != nil {
+			continue
+		}
+		// The response's wire size is spread over the events it held
+		deliver(sourceMessage{Data: data, Frame: frameSize{Wire: wire / len(matches), Decoded: len(data)}})
+	}
+	return nil
+}
+
+// stdinTransport reads NDJSON piped into the process, one message per line.
+// Stdin can only be read once, so the lines come from a single shared reader
+// and a source added again after removal continues where the last one stopped.
+type stdinTransport struct{}
+
+var (
+	stdinOnce  sync.Once
+	stdinLines chan []byte
+)
+
+func readStdinLines() <-chan []byte {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan []byte, 64)
+		go func() {
+			defer close(stdinLines)
+			scanner := bufio.NewScanner(os.Stdin)
+			scanner.Buffer(make([]byte, 0, 64*1024), localReadLimit)
+			for scanner.Scan() {
+				stdinLines <- append([]byte(nil), scanner.Bytes()...)
+			}
+		}()
+	})
+	return stdinLines
+}
+
+func (t *stdinTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	lines := readStdinLines()
+	connected()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return errSourceEnded
+			}
+			deliverLine(line, deliver)
+		}
+	}
+}
+
+// deliverLine sends one line of a line-oriented source, skipping blank lines.
+func deliverLine(line []byte, deliver func(sourceMessage)) {
+	wire := len(line) + 1 // the newline
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	deliver(sourceMessage{Data: line, Frame: frameSize{Wire: wire, Decoded: len(line)}})
+}
+
+// filePollInterval is how often a followed file is checked for new lines,
+// truncation and rotation.
+const filePollInterval = 250 * time.Millisecond
+
+// fileTransport follows a file like tail -f: it starts at the end, reads
+// lines as they are appended, starts over when the file is truncated, and
+// reopens the path when the file is rotated.
+type fileTransport struct {
+	path string
+
+	// Position in the last file read, so a retry after an error resumes
+	// instead of skipping or repeating lines.
+	info   os.FileInfo
+	offset int64
+}
+
+func (t *fileTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	file, err := t.open()
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+	connected()
+
+	reader := bufio.NewReader(file)
+	var partial []byte
+	for {
+		chunk, err := reader.ReadBytes('\n')
+		t.offset += int64(len(chunk))
+		if err == nil {
+			deliverLine(append(partial, chunk[:len(chunk)-1]...), deliver)
+			partial = nil
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		// Keep an unterminated last line until the writer finishes it
+		partial = append(partial, chunk...)
+		if len(partial) > localReadLimit {
+			deliver(sourceMessage{Dropped: "oversized_line"})
+			partial = nil
+		}
+
+		timer := time.NewTimer(filePollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		info, err := os.Stat(t.path)
+		switch {
+		case err != nil:
+			// Moved away and not yet recreated; keep reading the old file meanwhile
+			continue
+		case !os.SameFile(info, t.info):
+			// Rotated: finish with the new file from its start
+			next, err := os.Open(t.path)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file, t.info, t.offset, partial = next, info, 0, nil
+			reader.Reset(file)
+		case info.Size() < t.offset:
+			// Truncated in place
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			t.offset, partial = 0, nil
+			reader.Reset(file)
+		}
+	}
+}
+
+// open opens the file at the end on the first run and resumes the previous
+// position on later runs when it is still the same file.
+func (t *fileTransport) open() (*os.File, error) {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("%s is a directory", t.path)
+	}
+	switch {
+	case t.info == nil:
+		t.offset = info.Size()
+	case !os.SameFile(info, t.info) || info.Size() < t.offset:
+		t.offset = 0
+	}
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	t.info = info
+	return file, nil
+}
+
+// socketTransport reads newline-delimited messages from a TCP or Unix socket,
+// writing the connection messages as lines after connecting.
+type socketTransport struct {
+	network  string // "tcp" or "unix"
+	addr     string
+	messages []string
+}
+
+func (t *socketTransport) Run(ctx context.Context, connected func(), deliver func(sourceMessage)) error {
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := dialer.DialContext(dialCtx, t.network, t.addr)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, msg := range t.messages {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.WriteString(conn, msg+"\n"); err != nil {
+			return fmt.Errorf("send connection message: %w", err)
+		}
+	}
+	conn.SetWriteDeadline(time.Time{})
+	connected()
+
+	// Closing the connection unblocks the read when the source is closed
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), localReadLimit)
+	for scanner.Scan() {
+		deliverLine(scanner.Bytes(), deliver)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("connection closed by peer")
+}
+
+// jsonPathStep is one step of a parsed JSONPath: a member name, an array
+// index, or a wildcard over all members or elements.
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the JSONPath subset sources use: $, .key, ['key'],
+// [n] and [*] or .*. The leading $ is optional, so dotted paths such as
+// data.0.e work too; numeric keys index into arrays.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	var steps []jsonPathStep
+	for i := 0; i < len(path); {
+		if path[i] == '[' {
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			inner := strings.TrimSpace(path[i+1 : i+end])
+			i += end + 1
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index [%s] in %q", inner, path)
+				}
+				steps = append(steps, jsonPathStep{index: n, isIndex: true})
+			}
+			continue
+		}
+		if path[i] == '.' {
+			i++
+		} else if i > 0 {
+			return nil, fmt.Errorf("unexpected %q at offset %d in %q", path[i], i, path)
+		}
+		end := i
+		for end < len(path) && path[end] != '.' && path[end] != '[' {
+			end++
+		}
+		key := path[i:end]
+		switch key {
+		case "":
+			if end < len(path) && path[end] == '.' {
+				return nil, fmt.Errorf("recursive descent (..) is not supported")
+			}
+			return nil, fmt.Errorf("empty key at offset %d in %q", i, path)
+		case "*":
+			steps = append(steps, jsonPathStep{wildcard: true})
+		default:
+			steps = append(steps, jsonPathStep{key: key})
+		}
+		i = end
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns every value the path selects in a decoded JSON document.
+func evalJSONPath(doc interface{}, path string) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{doc}
+	for _, step := range steps {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, step.apply(v)...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func (s jsonPathStep) apply(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := make([]string, 0, len(val))
+			for k := range val {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			out := make([]interface{}, 0, len(val))
+			for _, k := range keys {
+				out = append(out, val[k])
+			}
+			return out
+		}
+		if s.isIndex {
+			return nil
+		}
+		if child, ok := val[s.key]; ok {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return val
+		}
+		idx := s.index
+		if !s.isIndex {
+			n, err := strconv.Atoi(s.key)
+			if err != nil {
+				return nil
+			}
+			idx = n
+		}
+		if idx < 0 {
+			idx += len(val)
+		}
+		if idx >= 0 && idx < len(val) {
+			return []interface{}{val[idx]}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	key := func(k string) jsonPathStep { return jsonPathStep{key: k} }
+	index := func(n int) jsonPathStep { return jsonPathStep{index: n, isIndex: true} }
+	wildcard := jsonPathStep{wildcard: true}
+
+	tests := []struct {
+		path    string
+		want    []jsonPathStep
+		wantErr bool
+	}{
+		{"$", nil, false},
+		{"", nil, false},
+		{"$.data", []jsonPathStep{key("data")}, false},
+		{"data.items", []jsonPathStep{key("data"), key("items")}, false},
+		{"$.data[0].e", []jsonPathStep{key("data"), index(0), key("e")}, false},
+		{"$['odd key'][\"x\"]", []jsonPathStep{key("odd key"), key("x")}, false},
+		{"$.items[*].price", []jsonPathStep{key("items"), wildcard, key("price")}, false},
+		{"$.items.*", []jsonPathStep{key("items"), wildcard}, false},
+		{"$[-1]", []jsonPathStep{index(-1)}, false},
+		{"data.0.e", []jsonPathStep{key("data"), key("0"), key("e")}, false},
+		{" $.a ", []jsonPathStep{key("a")}, false},
+		{"$.items[0", nil, true},
+		{"$.items[x]", nil, true},
+		{"$..price", nil, true},
+		{"$.a.", nil, true},
+		{"$a", []jsonPathStep{key("a")}, false}, // the $ is optional, even without a dot
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONPath(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "trade",
+		"data": [{"p": 1, "s": "A"}, {"p": 2, "s": "B"}, {"p": 3}],
+		"meta": {"b": "second", "a": "first"}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"$", []interface{}{doc}},
+		{"$.type", []interface{}{"trade"}},
+		{"$.data[0].p", []interface{}{1.0}},
+		{"data.1.s", []interface{}{"B"}},
+		{"$.data[-1].p", []interface{}{3.0}},
+		{"$.data[*].p", []interface{}{1.0, 2.0, 3.0}},
+		{"$.data[*].s", []interface{}{"A", "B"}},       // the third element has no s
+		{"$.meta.*", []interface{}{"first", "second"}}, // members in key order
+		{"$.data[9]", nil},
+		{"$.missing.deeper", nil},
+		{"$.type[0]", nil},
+		{"$.meta[0]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := evalJSONPath(doc, tt.path)
+			if err != nil {
+				t.Fatalf("evalJSONPath(%q): %v", tt.path, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evalJSONPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := evalJSONPath(doc, "$..p"); err == nil {
+		t.Error("evalJSONPath accepted recursive descent")
+	}
+}
+
+func TestFileTransportFollowsRotationAndTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.log")
+	if err := os.WriteFile(path, []byte("old line before start\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 16)
+	connected := make(chan struct{})
+	done := make(chan error, 1)
+	tr := &fileTransport{path: path}
+	go func() {
+		done <- tr.Run(ctx, func() { close(connected) }, func(m sourceMessage) { lines <- string(m.Data) })
+	}()
+	<-connected
+
+	appendTo := func(text string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("line = %q, want %q", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no line, want %q", want)
+		}
+	}
+
+	// Starts at the end: only appended lines are delivered
+	appendTo("first\n")
+	expect("first")
+
+	// An unterminated line waits for its newline
+	appendTo("par")
+	time.Sleep(2 * filePollInterval)
+	appendTo("tial\n")
+	expect("partial")
+
+	// Rotation: the old file is moved away and a new one created in its place
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("rotated and longer\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect("rotated and longer")
+
+	// Truncation in place starts over from the top
+	if err := os.WriteFile(path, []byte("short\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect("short")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v after cancel, want context.Canceled", err)
+	}
+	select {
+	case extra := <-lines:
+		t.Errorf("unexpected line %q", extra)
+	default:
+	}
+}
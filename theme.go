@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const defaultTheme = "cyan"
+
+// palette is the set of colors a theme swaps; the variable names in main.go
+// refer to the default cyan/magenta theme.
+type palette struct {
+	primary, dark, bright, dim    lipgloss.Color // cyanColor, darkCyanColor, ...
+	accent, darkAccent, dimAccent lipgloss.Color // tab colors (magentaColor, ...)
+}
+
+var themes = map[string]palette{
+	"cyan": {
+		primary: "#00FFFF", dark: "#008B8B", bright: "#00FFFF", dim: "#5F9EA0",
+		accent: "#FF00FF", darkAccent: "#8B008B", dimAccent: "#BA55D3",
+	},
+	"amber": {
+		primary: "#FFB000", dark: "#B8860B", bright: "#FFD75F", dim: "#C0A060",
+		accent: "#FF5F00", darkAccent: "#AF3A00", dimAccent: "#FF8C42",
+	},
+	"green": {
+		primary: "#5FFF87", dark: "#2E8B57", bright: "#87FFAF", dim: "#6B9E78",
+		accent: "#00AFFF", darkAccent: "#005F87", dimAccent: "#5FAFD7",
+	},
+	"mono": {
+		primary: "#E0E0E0", dark: "#707070", bright: "#FFFFFF", dim: "#A0A0A0",
+		accent: "#D0D0D0", darkAccent: "#5A5A5A", dimAccent: "#9A9A9A",
+	},
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyTheme swaps the package palette and restyles the shared styles built
+// from it. Styles created at render time pick up the new colors on their own.
+// Unknown names are ignored and reported as false.
+func applyTheme(name string) bool {
+	p, ok := themes[name]
+	if !ok {
+		return false
+	}
+	cyanColor, darkCyanColor, brightCyanColor, dimCyanColor = p.primary, p.dark, p.bright, p.dim
+	magentaColor, darkMagentaColor, dimMagentaColor = p.accent, p.darkAccent, p.dimAccent
+
+	activeTabStyle = activeTabStyle.Background(magentaColor)
+	inactiveTabStyle = inactiveTabStyle.Foreground(dimMagentaColor)
+	tabBarStyle = tabBarStyle.BorderForeground(darkMagentaColor)
+	boxStyle = boxStyle.BorderForeground(darkCyanColor)
+	helpStyle = helpStyle.Foreground(dimCyanColor)
+	contentStyle = contentStyle.BorderForeground(darkCyanColor)
+	metricLabelStyle = metricLabelStyle.Foreground(dimCyanColor)
+	sparklineCyanStyle = sparklineCyanStyle.Foreground(cyanColor)
+	feedItemSelectedStyle = feedItemSelectedStyle.Background(cyanColor)
+	feedItemNormalStyle = feedItemNormalStyle.Foreground(dimCyanColor)
+	gradientColors[0] = cyanColor
+	gradientColors[len(gradientColors)-1] = magentaColor
+	return true
+}
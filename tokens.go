@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// llmUsage is the token usage of one LLM request. Backends that relay the
+// provider's usage send it with the final frame; otherwise it is estimated
+// locally from the text that was sent and received.
+type llmUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int    // prompt tokens served from the provider's prompt cache
+	Model            string // model that answered, when the backend names it
+	Estimator        string // tokenizer behind estimated counts; "" when reported by the backend
+}
+
+// Estimated reports whether the counts were computed locally.
+func (u llmUsage) Estimated() bool {
+	return u.Estimator != ""
+}
+
+// promptSizes holds the estimated prompt size of each in-flight LLM request
+// by request ID. Commands count the prompt and record it before the query
+// goes out, so the answer's handler finds it however the two are ordered;
+// every copy of the model shares the one map.
+type promptSizes struct {
+	mu     sync.Mutex
+	tokens map[string]int
+}
+
+func newPromptSizes() *promptSizes {
+	return &promptSizes{tokens: make(map[string]int)}
+}
+
+// Set records the prompt size of a request.
+func (p *promptSizes) Set(requestID string, tokens int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[requestID] = tokens
+}
+
+// Take returns and forgets the prompt size of a request.
+func (p *promptSizes) Take(requestID string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tokens, ok := p.tokens[requestID]
+	delete(p.tokens, requestID)
+	return tokens, ok
+}
+
+// Reset forgets every recorded size.
+func (p *promptSizes) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens = make(map[string]int)
+}
+
+// heuristicEstimator names estimates made without a BPE vocabulary.
+const heuristicEstimator = "heuristic"
+
+// maxBPEPiece caps the bytes merged at once; merging is quadratic in the
+// piece length and long runs (base64, hex) are cut into chunks.
+const maxBPEPiece = 256
+
+// Pre-tokenizer patterns of the OpenAI vocabularies. RE2 has no lookahead,
+// so the trailing `\s+(?!\S)` alternative is applied by splitPieces instead.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+)
+
+var cl100kSplit = regexp.MustCompile(cl100kPattern)
+
+// tokenizerFromEnv returns the tokenizer to estimate unreported token counts
+// with. By default that is the o200k_base vocabulary compiled into the
+// binary; TURBOSTREAM_TOKENIZER_FILE names a tiktoken rank file to use
+// instead, or "off" for the heuristic estimate (a nil tokenizer). A rank
+// file that can't be read falls back to o200k_base with the error.
+func tokenizerFromEnv() (*bpeTokenizer, error) {
+	path := getenvDefault("TURBOSTREAM_TOKENIZER_FILE", "")
+	switch path {
+	case "off":
+		return nil, nil
+	case "":
+		return embeddedTokenizer(), nil
+	}
+	t, err := loadBPETokenizer(path)
+	if err != nil {
+		return embeddedTokenizer(), err
+	}
+	return t, nil
+}
+
+// bpeTokenizer counts tokens with a byte-level BPE vocabulary: either one
+// compiled in from tiktoken-go or one read from a rank file in tiktoken's
+// format, one base64 token and its merge rank per line. A nil tokenizer
+// falls back to a heuristic estimate.
+type bpeTokenizer struct {
+	name  string
+	codec tokenizer.Codec // set for the compiled-in vocabularies
+	ranks map[string]int
+	split *regexp.Regexp
+}
+
+// embeddedTokenizer returns the o200k_base vocabulary of GPT-4o and later
+// OpenAI models.
+func embeddedTokenizer() *bpeTokenizer {
+	return newCodecTokenizer(tokenizer.O200kBase)
+}
+
+func newCodecTokenizer(encoding tokenizer.Encoding) *bpeTokenizer {
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		panic(err) // only encodings tiktoken-go ships are passed in
+	}
+	return &bpeTokenizer{name: codec.GetName(), codec: codec}
+}
+
+// loadBPETokenizer reads a rank file. Files named after o200k use that
+// vocabulary's pre-tokenizer; everything else uses cl100k's.
+func loadBPETokenizer(path string) (*bpeTokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &bpeTokenizer{
+		name:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		ranks: make(map[string]int, 200000),
+		split: cl100kSplit,
+	}
+	if strings.Contains(t.name, "o200k") {
+		t.split = regexp.MustCompile(o200kPattern)
+	}
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"<base64 token> <rank>\"", path, line)
+		}
+		raw, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad rank %q", path, line, rank)
+		}
+		t.ranks[string(raw)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.ranks) < 256 {
+		return nil, fmt.Errorf("%s: not a BPE rank file (%d tokens)", path, len(t.ranks))
+	}
+	return t, nil
+}
+
+// Name returns the name estimates made with t are marked with.
+func (t *bpeTokenizer) Name() string {
+	if t == nil {
+		return heuristicEstimator
+	}
+	return t.name
+}
+
+// Count returns the number of tokens in text and the name of the tokenizer
+// that counted them.
+func (t *bpeTokenizer) Count(text string) (int, string) {
+	if t == nil {
+		return estimateTokens(text), heuristicEstimator
+	}
+	if t.codec != nil {
+		n, err := t.codec.Count(text)
+		if err != nil {
+			return estimateTokens(text), heuristicEstimator
+		}
+		return n, t.name
+	}
+	n := 0
+	splitPieces(t.split, text, func(piece string) {
+		for len(piece) > maxBPEPiece {
+			n += t.pieceTokens(piece[:maxBPEPiece])
+			piece = piece[maxBPEPiece:]
+		}
+		n += t.pieceTokens(piece)
+	})
+	return n, t.name
+}
+
+// pieceTokens runs the BPE merges over one pre-tokenized piece: starting from
+// single bytes, the adjacent pair with the lowest rank is merged until no
+// pair is in the vocabulary.
+func (t *bpeTokenizer) pieceTokens(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+	// bounds[i] is where the i-th token starts; the last entry is len(piece)
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := -1, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if r, ok := t.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || r < best) {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// splitPieces calls fn with each pre-tokenizer piece of text. A whitespace
+// run followed by text gives up its last character to the next piece, as
+// the `\s+(?!\S)` alternative would.
+func splitPieces(re *regexp.Regexp, text string, fn func(string)) {
+	for text != "" {
+		loc := re.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			fn(text)
+			return
+		}
+		if loc[0] > 0 {
+			fn(text[:loc[0]])
+		}
+		end := loc[1]
+		if piece := text[loc[0]:end]; end < len(text) && strings.TrimSpace(piece) == "" {
+			last, size := utf8.DecodeLastRuneInString(piece)
+			if last != '\n' && last != '\r' && size < len(piece) {
+				end -= size
+			}
+		}
+		fn(text[loc[0]:end])
+		text = text[end:]
+	}
+}
+
+// estimateTokens approximates a BPE count without a vocabulary: words and
+// numbers from the cl100k pre-tokenizer take about one token per five
+// characters, punctuation runs about one per two.
+func estimateTokens(text string) int {
+	n := 0
+	splitPieces(cl100kSplit, text, func(piece string) {
+		runes := utf8.RuneCountInString(piece)
+		if strings.TrimSpace(piece) == "" {
+			n++
+			return
+		}
+		if strings.IndexFunc(piece, isWordRune) >= 0 {
+			n += (runes + 4) / 5
+		} else {
+			n += (runes + 1) / 2
+		}
+	})
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// defaultContextWindow is assumed for models the table below doesn't know.
+const defaultContextWindow = 128000
+
+// contextWindows maps model name prefixes to their context window in
+// tokens; the longest matching prefix wins.
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-5":         400000,
+	"o1":            200000,
+	"o3":            200000,
+	"o4":            200000,
+	"claude":        200000,
+	"gemini":        1048576,
+	"llama-3":       128000,
+	"mistral-large": 128000,
+}
+
+// contextWindow returns the context window of model in tokens.
+func contextWindow(model string) int {
+	model = strings.ToLower(model)
+	// Provider-qualified names like "openai/gpt-4o" match on the model part
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	best, window := 0, defaultContextWindow
+	for prefix, w := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, window = len(prefix), w
+		}
+	}
+	return window
+}
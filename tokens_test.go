@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestSplitPieces(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"2 + 2 = 4", []string{"2", " +", " ", "2", " =", " ", "4"}},
+		{"hello  world", []string{"hello", " ", " world"}},
+		{"Hello\n\nworld", []string{"Hello", "\n\n", "world"}},
+		{"I'm here", []string{"I", "'m", " here"}},
+		{"1234567", []string{"123", "456", "7"}},
+		{`{"p":1.5}`, []string{`{"`, "p", `":`, "1", ".", "5", "}"}},
+		{"héllo wörld", []string{"héllo", " wörld"}},
+		{"end   ", []string{"end", "   "}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got []string
+			splitPieces(cl100kSplit, tt.text, func(piece string) { got = append(got, piece) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPieces(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// toyTokenizer knows every single byte plus a few merges, lowest rank first.
+func toyTokenizer() *bpeTokenizer {
+	ranks := make(map[string]int, 256)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, merge := range []string{"ab", "bc", "abc", " a"} {
+		ranks[merge] = 256 + i
+	}
+	return &bpeTokenizer{name: "toy", ranks: ranks, split: cl100kSplit}
+}
+
+func TestPieceTokens(t *testing.T) {
+	tok := toyTokenizer()
+	tests := []struct {
+		piece string
+		want  int
+	}{
+		{"a", 1},
+		{"abc", 1},    // in the vocabulary as is
+		{"abcab", 2},  // ab+c+ab, then abc+ab
+		{"cba", 3},    // no merges apply
+		{"bcab", 2},   // ab (rank 256) merges before bc
+		{" abc", 2},   // " a" loses to ab: " "+abc
+		{"xyzzy", 5},  // single bytes
+		{"ababab", 3}, // ab+ab+ab; "abab" is not a token
+	}
+	for _, tt := range tests {
+		if got := tok.pieceTokens(tt.piece); got != tt.want {
+			t.Errorf("pieceTokens(%q) = %d, want %d", tt.piece, got, tt.want)
+		}
+	}
+}
+
+func TestBPETokenizerCount(t *testing.T) {
+	tok := toyTokenizer()
+	if n, name := tok.Count("abc abc"); n != 3 || name != "toy" {
+		t.Errorf("Count = %d (%s), want 3 (toy)", n, name)
+	}
+	// Long pieces are counted in chunks of maxBPEPiece bytes
+	long := strings.Repeat("c", 3*maxBPEPiece+1)
+	if n, _ := tok.Count(long); n != len(long) {
+		t.Errorf("Count of %d unmergeable bytes = %d", len(long), n)
+	}
+
+	var none *bpeTokenizer
+	if n, name := none.Count("hello world"); n != estimateTokens("hello world") || name != heuristicEstimator {
+		t.Errorf("nil tokenizer Count = %d (%s), want the heuristic estimate", n, name)
+	}
+	if none.Name() != heuristicEstimator {
+		t.Errorf("nil tokenizer Name() = %q", none.Name())
+	}
+}
+
+func TestLoadBPETokenizer(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, lines []string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var lines []string
+	for b := 0; b < 256; b++ {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b))
+	}
+	lines = append(lines, base64.StdEncoding.EncodeToString([]byte("ab"))+" 256")
+
+	tok, err := loadBPETokenizer(write("toy_base.tiktoken", lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, name := tok.Count("abab"); n != 2 || name != "toy_base" {
+		t.Errorf("Count(abab) = %d (%s), want 2 (toy_base)", n, name)
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"too small", lines[:10]},
+		{"no rank", append(lines[:256:256], "YWI=")},
+		{"bad base64", append(lines[:256:256], "!!! 300")},
+		{"bad rank", append(lines[:256:256], "YWI= x")},
+	}
+	for _, tt := range tests {
+		if _, err := loadBPETokenizer(write("bad.tiktoken", tt.lines)); err == nil {
+			t.Errorf("%s: loaded without an error", tt.name)
+		}
+	}
+}
+
+// TestEmbeddedCounts checks known tiktoken counts against the compiled-in
+// vocabularies.
+func TestEmbeddedCounts(t *testing.T) {
+	tests := []struct {
+		encoding tokenizer.Encoding
+		text     string
+		want     int
+	}{
+		{tokenizer.Cl100kBase, "hello world", 2},
+		{tokenizer.Cl100kBase, "tiktoken is great!", 6},
+		{tokenizer.Cl100kBase, "2 + 2 = 4", 7},
+		{tokenizer.Cl100kBase, "", 0},
+		{tokenizer.O200kBase, "hello world", 2},
+		{tokenizer.O200kBase, "tiktoken is great!", 6},
+		{tokenizer.O200kBase, "2 + 2 = 4", 7},
+	}
+	for _, tt := range tests {
+		tok := newCodecTokenizer(tt.encoding)
+		if got, name := tok.Count(tt.text); got != tt.want || name != string(tt.encoding) {
+			t.Errorf("%s Count(%q) = %d (%s), want %d", tt.encoding, tt.text, got, name, tt.want)
+		}
+	}
+}
+
+func TestTokenizerFromEnv(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.tiktoken")
+	if err := os.WriteFile(bad, []byte("YWI= 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		env      string
+		wantName string
+		wantErr  bool
+	}{
+		{"", "o200k_base", false},
+		{"off", heuristicEstimator, false},
+		{bad, "o200k_base", true}, // falls back to the built-in vocabulary
+		{filepath.Join(t.TempDir(), "missing.tiktoken"), "o200k_base", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TURBOSTREAM_TOKENIZER_FILE", tt.env)
+		tok, err := tokenizerFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("TURBOSTREAM_TOKENIZER_FILE=%q: error = %v, wantErr %v", tt.env, err, tt.wantErr)
+		}
+		if got := tok.Name(); got != tt.wantName {
+			t.Errorf("TURBOSTREAM_TOKENIZER_FILE=%q: tokenizer %q, want %q", tt.env, got, tt.wantName)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 3}, // words: a token per five characters, rounded up
+		{"2 + 2 = 4", 7},   // every piece is at least one
+		{"!!!!", 2},        // punctuation: a token per two characters
+		{"a\n\nb", 3},      // newline runs are one piece
+		{"internationalization", 4},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+const keyringService = "turbostream-tui"
+
+// storedSession is what survives a restart: enough to restore the session via
+// fetchMeCmd and to refresh it before it expires.
+type storedSession struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// tokenStore persists the session for one backend.
+type tokenStore interface {
+	Load() (storedSession, error) // returns an empty session when nothing is stored
+	Save(storedSession) error
+	Clear() error
+	Name() string
+}
+
+// newTokenStore prefers the OS keyring and falls back to a sealed file
+// when no keyring is reachable (e.g. headless Linux without a Secret Service).
+func newTokenStore(backendURL string) tokenStore {
+	ks := keyringStore{account: backendURL}
+	if _, err := keyring.Get(keyringService, ks.account); err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return ks
+	}
+	return newFileStore(backendURL)
+}
+
+// keyringStore keeps the session in the OS keychain / Secret Service / Credential Manager.
+type keyringStore struct {
+	account string
+}
+
+func (k keyringStore) Name() string { return "keyring" }
+
+func (k keyringStore) Load() (storedSession, error) {
+	var sess storedSession
+	data, err := keyring.Get(keyringService, k.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return sess, nil
+	}
+	if err != nil {
+		return sess, err
+	}
+	err = json.Unmarshal([]byte(data), &sess)
+	return sess, err
+}
+
+func (k keyringStore) Save(sess storedSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keyringService, k.account, string(data))
+}
+
+func (k keyringStore) Clear() error {
+	err := keyring.Delete(keyringService, k.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// fileStore keeps the session AES-GCM sealed in the user config directory.
+// Only TURBOSTREAM_TOKEN_PASSPHRASE makes that encryption: without it the key
+// is derived from the machine ID, hostname and uid, which any local user can
+// read, so the file is merely obfuscated and protected by its 0600 mode.
+// Either secret is stretched with scrypt and a random per-file salt.
+type fileStore struct {
+	path    string
+	account string
+}
+
+func newFileStore(backendURL string) fileStore {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return fileStore{
+		path:    filepath.Join(dir, "turbostream", "sessions.enc"),
+		account: backendURL,
+	}
+}
+
+func (f fileStore) Name() string {
+	if sessionPassphrase() == "" {
+		return "obfuscated file (set TURBOSTREAM_TOKEN_PASSPHRASE to encrypt it)"
+	}
+	return "encrypted file"
+}
+
+// sessions are stored per backend URL in a single encrypted JSON object.
+func (f fileStore) readAll() (map[string]storedSession, error) {
+	all := map[string]storedSession{}
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plain, legacy, err := decryptSession(data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", f.path, err)
+	}
+	if err := json.Unmarshal(plain, &all); err != nil {
+		return nil, err
+	}
+	if legacy {
+		// Reseal under a salted key; if that fails the old file still opens
+		_ = f.writeAll(all)
+	}
+	return all, nil
+}
+
+func (f fileStore) writeAll(all map[string]storedSession) error {
+	if len(all) == 0 {
+		err := os.Remove(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	plain, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	data, err := encryptSession(plain)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0o600)
+}
+
+func (f fileStore) Load() (storedSession, error) {
+	all, err := f.readAll()
+	if err != nil {
+		return storedSession{}, err
+	}
+	return all[f.account], nil
+}
+
+func (f fileStore) Save(sess storedSession) error {
+	all, err := f.readAll()
+	if err != nil {
+		// Unreadable (e.g. the key changed); start over rather than lock the user out
+		all = map[string]storedSession{}
+	}
+	all[f.account] = sess
+	return f.writeAll(all)
+}
+
+func (f fileStore) Clear() error {
+	all, err := f.readAll()
+	if err != nil {
+		// Nothing we can read is worth keeping
+		return f.writeAll(nil)
+	}
+	delete(all, f.account)
+	return f.writeAll(all)
+}
+
+func sessionPassphrase() string {
+	return os.Getenv("TURBOSTREAM_TOKEN_PASSPHRASE")
+}
+
+// Session files start with sessionFileMagic, a big-endian uint16 format
+// version and the scrypt salt. Files from before the header (version 1)
+// are sealed with a bare SHA-256 of the secret and are resealed when read.
+const (
+	sessionFileMagic   = "TSSF"
+	sessionFileVersion = 2
+	sessionSaltSize    = 16
+	sessionHeaderSize  = len(sessionFileMagic) + 2 + sessionSaltSize
+)
+
+// scrypt cost of the session key: the parameters recommended for
+// interactive logins, around 100ms and 32 MiB per derivation.
+const (
+	sessionScryptN = 1 << 15
+	sessionScryptR = 8
+	sessionScryptP = 1
+)
+
+// sessionSecret returns what the file store key is derived from. The
+// machine-derived fallback only keeps a copied file from opening elsewhere;
+// it is not a secret.
+func sessionSecret() []byte {
+	if pass := sessionPassphrase(); pass != "" {
+		return []byte(pass)
+	}
+	var seed strings.Builder
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id, err := os.ReadFile(path); err == nil {
+			seed.Write(id)
+			break
+		}
+	}
+	if host, err := os.Hostname(); err == nil {
+		seed.WriteString(host)
+	}
+	if u, err := user.Current(); err == nil {
+		seed.WriteString(u.Uid)
+		seed.WriteString(u.Username)
+	}
+	return []byte("turbostream-session:" + seed.String())
+}
+
+// sessionKey stretches the secret with the file's salt.
+func sessionKey(salt []byte) ([]byte, error) {
+	return scrypt.Key(sessionSecret(), salt, sessionScryptN, sessionScryptR, sessionScryptP, 32)
+}
+
+// legacySessionKey is the unsalted key of version 1 files.
+func legacySessionKey() []byte {
+	sum := sha256.Sum256(sessionSecret())
+	return sum[:]
+}
+
+func encryptSession(plain []byte) ([]byte, error) {
+	header := make([]byte, sessionHeaderSize)
+	copy(header, sessionFileMagic)
+	binary.BigEndian.PutUint16(header[len(sessionFileMagic):], sessionFileVersion)
+	salt := header[len(header)-sessionSaltSize:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := sessionKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := sessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(append(header, nonce...), nonce, plain, nil), nil
+}
+
+// decryptSession opens a session file of either version; legacy reports a
+// version 1 file.
+func decryptSession(data []byte) (plain []byte, legacy bool, err error) {
+	var key []byte
+	if strings.HasPrefix(string(data), sessionFileMagic) {
+		if len(data) < sessionHeaderSize {
+			return nil, false, errors.New("file too short")
+		}
+		if v := binary.BigEndian.Uint16(data[len(sessionFileMagic):]); v != sessionFileVersion {
+			return nil, false, fmt.Errorf("unsupported format version %d", v)
+		}
+		if key, err = sessionKey(data[sessionHeaderSize-sessionSaltSize : sessionHeaderSize]); err != nil {
+			return nil, false, err
+		}
+		data = data[sessionHeaderSize:]
+	} else {
+		key, legacy = legacySessionKey(), true
+	}
+	gcm, err := sessionCipher(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, false, errors.New("file too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err = gcm.Open(nil, nonce, sealed, nil)
+	return plain, legacy, err
+}
+
+func sessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionFileRoundTrip(t *testing.T) {
+	t.Setenv("TURBOSTREAM_TOKEN_PASSPHRASE", "correct horse")
+	f := fileStore{path: filepath.Join(t.TempDir(), "sessions.enc"), account: "https://a.example"}
+	want := storedSession{Token: "jwt", RefreshToken: "refresh"}
+	if err := f.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(sessionFileMagic)) {
+		t.Errorf("file starts with %q, want the %q header", data[:len(sessionFileMagic)], sessionFileMagic)
+	}
+	if bytes.Contains(data, []byte("jwt")) {
+		t.Error("token stored in the clear")
+	}
+
+	t.Setenv("TURBOSTREAM_TOKEN_PASSPHRASE", "wrong horse")
+	if _, err := f.Load(); err == nil {
+		t.Error("file opened with the wrong passphrase")
+	}
+}
+
+func TestEncryptSessionSalt(t *testing.T) {
+	t.Setenv("TURBOSTREAM_TOKEN_PASSPHRASE", "correct horse")
+	a, err := encryptSession([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encryptSession([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a[:sessionHeaderSize], b[:sessionHeaderSize]) {
+		t.Error("two files share a salt")
+	}
+}
+
+func TestDecryptSessionErrors(t *testing.T) {
+	t.Setenv("TURBOSTREAM_TOKEN_PASSPHRASE", "correct horse")
+	sealed, err := encryptSession([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := bytes.Clone(sealed)
+	future[len(sessionFileMagic)+1]++
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"header only", sealed[:sessionHeaderSize-1]},
+		{"newer version", future},
+		{"tampered", tampered},
+		{"legacy too short", []byte("abc")},
+	}
+	for _, tt := range tests {
+		if _, _, err := decryptSession(tt.data); err == nil {
+			t.Errorf("%s: decrypted without an error", tt.name)
+		}
+	}
+}
+
+func TestSessionFileMigratesLegacyFormat(t *testing.T) {
+	t.Setenv("TURBOSTREAM_TOKEN_PASSPHRASE", "correct horse")
+	f := fileStore{path: filepath.Join(t.TempDir(), "sessions.enc"), account: "https://a.example"}
+
+	// Version 1: nonce and ciphertext under a bare SHA-256 of the passphrase
+	plain, err := json.Marshal(map[string]storedSession{f.account: {Token: "old"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := sessionCipher(legacySessionKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f.path, gcm.Seal(nonce, nonce, plain, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Token != "old" {
+		t.Errorf("Load = %+v, want the legacy session", got)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, legacy, err := decryptSession(data); err != nil || legacy {
+		t.Errorf("file after Load: legacy = %v, err = %v; want it resealed", legacy, err)
+	}
+	if got, err := f.Load(); err != nil || got.Token != "old" {
+		t.Errorf("Load after migration = %+v, %v", got, err)
+	}
+}
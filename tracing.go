@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turboline-ai/turbostream-tui/pkg/api"
+)
+
+// Spans are exported as OTLP/HTTP JSON, which any OpenTelemetry collector
+// accepts on :4318, so tracing needs no SDK.
+
+const (
+	spanKindClient = 3
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+
+	traceBatchSize     = 64
+	traceFlushInterval = 5 * time.Second
+	traceQueueLimit    = 2048 // spans beyond this are dropped while the collector is unreachable
+
+	// llmSpanTimeout ends the span of a request that never got a final frame
+	llmSpanTimeout = 10 * time.Minute
+)
+
+// tracingConfig says where spans go; tracing is off without an Endpoint.
+type tracingConfig struct {
+	Endpoint string // full URL of the collector's traces endpoint
+	Headers  map[string]string
+	Service  string
+	Resource map[string]string // extra resource attributes
+}
+
+// tracingConfigFromEnv reads the standard OTEL_* variables. endpoint, from
+// --otlp-endpoint, takes precedence over them.
+func tracingConfigFromEnv(endpoint string) (tracingConfig, error) {
+	cfg := tracingConfig{
+		Service:  getenvDefault("OTEL_SERVICE_NAME", "turbostream-tui"),
+		Headers:  parseOTELList(getenvDefault("OTEL_EXPORTER_OTLP_HEADERS", "")),
+		Resource: parseOTELList(getenvDefault("OTEL_RESOURCE_ATTRIBUTES", "")),
+	}
+	for k, v := range parseOTELList(getenvDefault("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "")) {
+		cfg.Headers[k] = v
+	}
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") && endpoint == "" {
+		return cfg, nil
+	}
+	// Spans are only encoded as OTLP/HTTP JSON; collectors take it on the same port as protobuf
+	protocol := getenvDefault("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", getenvDefault("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json"))
+	switch protocol {
+	case "http/json":
+	case "http/protobuf", "grpc":
+		return cfg, fmt.Errorf("OTLP protocol %s is not supported; set OTEL_EXPORTER_OTLP_PROTOCOL=http/json and use the collector's OTLP/HTTP port (4318)", protocol)
+	default:
+		return cfg, fmt.Errorf("unknown OTLP protocol %q (supported: http/json)", protocol)
+	}
+
+	switch {
+	case endpoint != "":
+		cfg.Endpoint = endpoint
+	case os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "":
+		// The signal-specific endpoint is used as given
+		cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+			return cfg, fmt.Errorf("invalid OTLP endpoint %q", cfg.Endpoint)
+		}
+		return cfg, nil
+	case os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "":
+		cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	default:
+		return cfg, nil
+	}
+
+	// A base endpoint gets the traces path, and a bare host:port a scheme
+	if !strings.Contains(cfg.Endpoint, "://") {
+		cfg.Endpoint = "http://" + cfg.Endpoint
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return cfg, fmt.Errorf("invalid OTLP endpoint %q", cfg.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	cfg.Endpoint = u.String()
+	return cfg, nil
+}
+
+// parseOTELList parses the "k1=v1,k2=v2" lists of OTEL_* variables, whose
+// values may be percent-encoded.
+func parseOTELList(s string) map[string]string {
+	out := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(item, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = decoded
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+type spanAttr struct {
+	Key   string
+	Value interface{} // string, bool, int64 or float64
+}
+
+type spanEvent struct {
+	Name  string
+	Time  time.Time
+	Attrs []spanAttr
+}
+
+// span is one finished or in-flight operation of a trace.
+type span struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Name    string
+	Kind    int
+	Start   time.Time
+	End     time.Time
+	Attrs   []spanAttr
+	Events  []spanEvent
+	Status  int    // unset (0), OK or error
+	Message string // status description, for errors
+}
+
+func newSpan(name string, kind int) *span {
+	s := &span{Name: name, Kind: kind, Start: time.Now()}
+	rand.Read(s.TraceID[:])
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+func (s *span) set(key string, value interface{}) {
+	s.Attrs = append(s.Attrs, spanAttr{key, value})
+}
+
+func (s *span) event(name string, attrs ...spanAttr) {
+	s.Events = append(s.Events, spanEvent{Name: name, Time: time.Now(), Attrs: attrs})
+}
+
+func (s *span) fail(err error) {
+	s.Status = spanStatusError
+	s.Message = err.Error()
+	s.event("exception", spanAttr{"exception.message", err.Error()})
+}
+
+// traceparent is the W3C Trace Context header naming s as the parent.
+func (s *span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.TraceID[:]) + "-" + hex.EncodeToString(s.SpanID[:]) + "-01"
+}
+
+// llmSpan is the root span of one LLM request, from the query to its final token.
+type llmSpan struct {
+	*span
+	tokens int // streamed chunks so far
+}
+
+// llmResult is how an LLM request ended.
+type llmResult struct {
+	Provider string
+	Usage    llmUsage
+	Duration int64 // generation time reported by the backend, in ms
+	Err      error
+}
+
+// tracer records LLM requests and REST calls as spans and exports them in
+// batches. A nil tracer records nothing.
+type tracer struct {
+	cfg    tracingConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	llm     map[string]*llmSpan // requestID -> root span
+	queue   []*span
+	err     error // first export failure, until Err takes it
+	failing bool  // exports fail; reported once until one succeeds again
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newTracer exports through transport, so the collector is reached with the
+// same proxy, CA bundle and client certificate as the backend.
+func newTracer(cfg tracingConfig, transport *http.Transport) *tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if transport != nil {
+		client.Transport = transport
+	}
+	t := &tracer{
+		cfg:    cfg,
+		client: client,
+		llm:    make(map[string]*llmSpan),
+		kick:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// instrument makes client report its requests to t.
+func (t *tracer) instrument(client *api.Client) {
+	if t != nil && client != nil {
+		client.SetTracer(t)
+	}
+}
+
+// StartLLM opens the root span of an LLM request and returns the
+// traceparent to send with the query.
+func (t *tracer) StartLLM(requestID, feedID, feedName string, eventsInContext int) string {
+	if t == nil {
+		return ""
+	}
+	s := newSpan("llm.query", spanKindClient)
+	s.set("turbostream.request_id", requestID)
+	s.set("turbostream.feed.id", feedID)
+	s.set("turbostream.feed.name", feedName)
+	s.set("turbostream.llm.events_in_context", int64(eventsInContext))
+
+	t.mu.Lock()
+	t.llm[requestID] = &llmSpan{span: s}
+	t.mu.Unlock()
+	return s.traceparent()
+}
+
+// LLMToken marks the first streamed token of a request and counts the rest.
+func (t *tracer) LLMToken(requestID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ls, ok := t.llm[requestID]
+	if !ok {
+		return
+	}
+	if ls.tokens == 0 {
+		ls.event("first_token", spanAttr{"turbostream.llm.ttft_ms", time.Since(ls.Start).Milliseconds()})
+	}
+	ls.tokens++
+}
+
+// EndLLM closes the span of a request once its final frame has arrived.
+func (t *tracer) EndLLM(requestID string, res llmResult) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ls, ok := t.llm[requestID]
+	if !ok {
+		return
+	}
+	delete(t.llm, requestID)
+
+	ls.set("turbostream.llm.chunks", int64(ls.tokens))
+	if res.Err != nil {
+		ls.fail(res.Err)
+	} else {
+		ls.set("gen_ai.system", res.Provider)
+		ls.set("gen_ai.usage.input_tokens", int64(res.Usage.PromptTokens))
+		ls.set("gen_ai.usage.output_tokens", int64(res.Usage.CompletionTokens))
+		if res.Usage.Model != "" {
+			ls.set("gen_ai.response.model", res.Usage.Model)
+		}
+		if res.Usage.CachedTokens > 0 {
+			ls.set("turbostream.llm.cached_tokens", int64(res.Usage.CachedTokens))
+		}
+		if res.Usage.Estimated() {
+			ls.set("turbostream.llm.tokens_estimated_by", res.Usage.Estimator)
+		}
+		if res.Duration > 0 {
+			ls.set("turbostream.llm.backend_duration_ms", res.Duration)
+		}
+		ls.event("completion", spanAttr{"turbostream.llm.generation_ms", time.Since(ls.Start).Milliseconds()})
+		ls.Status = spanStatusOK
+	}
+	t.finishLocked(ls.span)
+}
+
+// CancelLLM closes the span of a request the user cancelled.
+func (t *tracer) CancelLLM(requestID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ls, ok := t.llm[requestID]
+	if !ok {
+		return
+	}
+	delete(t.llm, requestID)
+	ls.set("turbostream.llm.chunks", int64(ls.tokens))
+	ls.set("turbostream.llm.cancelled", true)
+	ls.event("cancelled")
+	t.finishLocked(ls.span)
+}
+
+// StartRequest implements api.Tracer with one client span per attempt.
+func (t *tracer) StartRequest(req *http.Request, resend int) func(*http.Response, error) {
+	s := newSpan(req.Method+" "+req.URL.Path, spanKindClient)
+	s.set("http.request.method", req.Method)
+	s.set("url.full", redactURL(req.URL))
+	s.set("server.address", req.URL.Hostname())
+	if resend > 0 {
+		s.set("http.request.resend_count", int64(resend))
+	}
+	req.Header.Set("traceparent", s.traceparent())
+
+	return func(resp *http.Response, err error) {
+		if resp != nil {
+			s.set("http.response.status_code", int64(resp.StatusCode))
+		}
+		if err != nil {
+			s.fail(err)
+			var httpErr *api.HTTPError
+			if errors.As(err, &httpErr) {
+				s.set("error.type", strconv.Itoa(httpErr.StatusCode))
+			}
+		}
+		t.mu.Lock()
+		t.finishLocked(s)
+		t.mu.Unlock()
+	}
+}
+
+func redactURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	c.RawQuery = ""
+	return c.String()
+}
+
+func (t *tracer) finishLocked(s *span) {
+	s.End = time.Now()
+	if len(t.queue) >= traceQueueLimit {
+		return
+	}
+	t.queue = append(t.queue, s)
+	if len(t.queue) >= traceBatchSize {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.kick:
+		case <-t.stop:
+			return
+		}
+		t.mu.Lock()
+		t.expireLocked(time.Now())
+		t.mu.Unlock()
+		t.report(t.flush(context.Background()))
+	}
+}
+
+// expireLocked ends the spans of requests that have gone without a final
+// frame for llmSpanTimeout, so they are exported instead of held until exit.
+func (t *tracer) expireLocked(now time.Time) {
+	for requestID, ls := range t.llm {
+		if now.Sub(ls.Start) < llmSpanTimeout {
+			continue
+		}
+		ls.set("turbostream.llm.chunks", int64(ls.tokens))
+		ls.fail(fmt.Errorf("no final frame within %s", llmSpanTimeout))
+		t.finishLocked(ls.span)
+		delete(t.llm, requestID)
+	}
+}
+
+// report keeps the first of a run of export failures for Err.
+func (t *tracer) report(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		t.failing = false
+		return
+	}
+	if !t.failing {
+		t.failing = true
+		t.err = err
+	}
+}
+
+// Err returns the export failure not yet reported, if any. Repeated failures
+// are reported once, until an export succeeds again.
+func (t *tracer) Err() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.err
+	t.err = nil
+	return err
+}
+
+// flush sends the queued spans. A failed batch is dropped rather than
+// retried so an absent collector can't grow the queue.
+func (t *tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export spans: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP collector at %s returned %s", t.cfg.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// Close ends the requests still streaming and sends what is left.
+func (t *tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	close(t.stop)
+	<-t.done
+
+	t.mu.Lock()
+	for requestID, ls := range t.llm {
+		ls.fail(errors.New("TUI exited before the response completed"))
+		t.finishLocked(ls.span)
+		delete(t.llm, requestID)
+	}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return t.flush(ctx)
+}
+
+// OTLP/HTTP JSON encoding. IDs are hex and 64-bit integers are strings.
+
+type otlpAttr struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttrs(attrs []spanAttr) []otlpAttr {
+	out := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]interface{}
+		switch x := a.Value.(type) {
+		case bool:
+			v = map[string]interface{}{"boolValue": x}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": x}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpAttr{Key: a.Key, Value: v})
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (t *tracer) otlpRequest(spans []*span) map[string]interface{} {
+	resource := []spanAttr{
+		{"service.name", t.cfg.Service},
+		{"telemetry.sdk.language", "go"},
+	}
+	for k, v := range t.cfg.Resource {
+		if k != "service.name" {
+			resource = append(resource, spanAttr{k, v})
+		}
+	}
+
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		events := make([]map[string]interface{}, 0, len(s.Events))
+		for _, e := range s.Events {
+			events = append(events, map[string]interface{}{
+				"name":         e.Name,
+				"timeUnixNano": unixNano(e.Time),
+				"attributes":   otlpAttrs(e.Attrs),
+			})
+		}
+		status := map[string]interface{}{"code": s.Status}
+		if s.Message != "" {
+			status["message"] = s.Message
+		}
+		encoded = append(encoded, map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.TraceID[:]),
+			"spanId":            hex.EncodeToString(s.SpanID[:]),
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": unixNano(s.Start),
+			"endTimeUnixNano":   unixNano(s.End),
+			"attributes":        otlpAttrs(s.Attrs),
+			"events":            events,
+			"status":            status,
+		})
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{"attributes": otlpAttrs(resource)},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "github.com/turboline-ai/turbostream-tui"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// OTLP/JSON trace export request, as in opentelemetry-proto's
+// collector/trace/v1 and trace/v1 with the OTLP/JSON mapping: lowerCamelCase
+// field names, hex trace and span IDs, and 64-bit integers as strings.
+type otlpJSONRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Spans []otlpJSONSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type otlpJSONSpan struct {
+	TraceID           string             `json:"traceId"`
+	SpanID            string             `json:"spanId"`
+	Name              string             `json:"name"`
+	Kind              int                `json:"kind"`
+	StartTimeUnixNano string             `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string             `json:"endTimeUnixNano"`
+	Attributes        []otlpJSONKeyValue `json:"attributes"`
+	Events            []struct {
+		Name         string             `json:"name"`
+		TimeUnixNano string             `json:"timeUnixNano"`
+		Attributes   []otlpJSONKeyValue `json:"attributes"`
+	} `json:"events"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string  `json:"stringValue"`
+		BoolValue   *bool    `json:"boolValue"`
+		IntValue    *string  `json:"intValue"`
+		DoubleValue *float64 `json:"doubleValue"`
+	} `json:"value"`
+}
+
+// check validates the value against the AnyValue rules and returns it as text.
+func (kv otlpJSONKeyValue) check(t *testing.T) string {
+	t.Helper()
+	v := kv.Value
+	var set []string
+	if v.StringValue != nil {
+		set = append(set, *v.StringValue)
+	}
+	if v.BoolValue != nil {
+		set = append(set, strconv.FormatBool(*v.BoolValue))
+	}
+	if v.IntValue != nil {
+		if _, err := strconv.ParseInt(*v.IntValue, 10, 64); err != nil {
+			t.Errorf("attribute %s: intValue %q is not a decimal string", kv.Key, *v.IntValue)
+		}
+		set = append(set, *v.IntValue)
+	}
+	if v.DoubleValue != nil {
+		set = append(set, strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64))
+	}
+	if len(set) != 1 {
+		t.Errorf("attribute %s has %d values, want exactly one", kv.Key, len(set))
+		return ""
+	}
+	return set[0]
+}
+
+func checkOTLPTime(t *testing.T, what, s string) time.Time {
+	t.Helper()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		t.Errorf("%s = %q, want positive nanoseconds as a string", what, s)
+	}
+	return time.Unix(0, n)
+}
+
+// fakeCollector records the bodies posted to it and answers with status.
+type fakeCollector struct {
+	mu     sync.Mutex
+	status int
+	bodies [][]byte
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	c.bodies = append(c.bodies, body)
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+}
+
+func (c *fakeCollector) setStatus(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+func TestTracerExportsOTLPJSON(t *testing.T) {
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	tr := newTracer(tracingConfig{
+		Endpoint: srv.URL + "/v1/traces",
+		Service:  "tui-test",
+		Resource: map[string]string{"deployment.environment": "test"},
+	}, nil)
+	traceparent := tr.StartLLM("req-1", "feed-1", "Trades", 12)
+	tr.LLMToken("req-1")
+	tr.LLMToken("req-1")
+	tr.EndLLM("req-1", llmResult{Provider: "openai", Usage: llmUsage{PromptTokens: 100, CompletionTokens: 20, Model: "gpt-4o"}})
+	tr.StartLLM("req-2", "feed-1", "Trades", 3)
+	tr.CancelLLM("req-2")
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(collector.bodies) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(collector.bodies))
+	}
+	dec := json.NewDecoder(bytes.NewReader(collector.bodies[0]))
+	dec.DisallowUnknownFields()
+	var req otlpJSONRequest
+	if err := dec.Decode(&req); err != nil {
+		t.Fatalf("not an OTLP/JSON export request: %v\n%s", err, collector.bodies[0])
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("want one resource with one scope, got %+v", req)
+	}
+
+	resource := map[string]string{}
+	for _, kv := range req.ResourceSpans[0].Resource.Attributes {
+		resource[kv.Key] = kv.check(t)
+	}
+	if resource["service.name"] != "tui-test" || resource["deployment.environment"] != "test" {
+		t.Errorf("resource attributes = %v", resource)
+	}
+	scope := req.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name == "" {
+		t.Error("scope has no name")
+	}
+
+	spans := scope.Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	for _, s := range spans {
+		if id, err := hex.DecodeString(s.TraceID); err != nil || len(id) != 16 {
+			t.Errorf("traceId %q is not 16 hex bytes", s.TraceID)
+		}
+		if id, err := hex.DecodeString(s.SpanID); err != nil || len(id) != 8 {
+			t.Errorf("spanId %q is not 8 hex bytes", s.SpanID)
+		}
+		if s.Name != "llm.query" || s.Kind != spanKindClient {
+			t.Errorf("span %s kind %d, want llm.query kind %d", s.Name, s.Kind, spanKindClient)
+		}
+		start := checkOTLPTime(t, "startTimeUnixNano", s.StartTimeUnixNano)
+		end := checkOTLPTime(t, "endTimeUnixNano", s.EndTimeUnixNano)
+		if end.Before(start) {
+			t.Errorf("span ends before it starts")
+		}
+		for _, e := range s.Events {
+			checkOTLPTime(t, "event timeUnixNano", e.TimeUnixNano)
+			for _, kv := range e.Attributes {
+				kv.check(t)
+			}
+		}
+	}
+
+	done := spans[0]
+	if want := "00-" + done.TraceID + "-" + done.SpanID + "-01"; traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+	attrs := map[string]string{}
+	for _, kv := range done.Attributes {
+		attrs[kv.Key] = kv.check(t)
+	}
+	for key, want := range map[string]string{
+		"turbostream.request_id":            "req-1",
+		"turbostream.feed.id":               "feed-1",
+		"turbostream.llm.events_in_context": "12",
+		"turbostream.llm.chunks":            "2",
+		"gen_ai.system":                     "openai",
+		"gen_ai.usage.input_tokens":         "100",
+		"gen_ai.usage.output_tokens":        "20",
+		"gen_ai.response.model":             "gpt-4o",
+	} {
+		if attrs[key] != want {
+			t.Errorf("attribute %s = %q, want %q", key, attrs[key], want)
+		}
+	}
+	if done.Status.Code != spanStatusOK {
+		t.Errorf("status = %d, want OK", done.Status.Code)
+	}
+	var events []string
+	for _, e := range done.Events {
+		events = append(events, e.Name)
+	}
+	if strings.Join(events, ",") != "first_token,completion" {
+		t.Errorf("events = %v, want first_token and completion", events)
+	}
+}
+
+func TestTracerReportsExportFailureOnce(t *testing.T) {
+	collector := &fakeCollector{status: http.StatusNotFound}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+	tr := &tracer{cfg: tracingConfig{Endpoint: srv.URL + "/v1/traces"}, client: srv.Client(), llm: map[string]*llmSpan{}}
+
+	export := func() {
+		tr.mu.Lock()
+		tr.finishLocked(newSpan("GET /api/feeds", spanKindClient))
+		tr.mu.Unlock()
+		tr.report(tr.flush(t.Context()))
+	}
+
+	export()
+	if err := tr.Err(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Err() = %v, want the 404", err)
+	}
+	export()
+	if err := tr.Err(); err != nil {
+		t.Errorf("repeated failure reported again: %v", err)
+	}
+
+	collector.setStatus(0)
+	export()
+	collector.setStatus(http.StatusServiceUnavailable)
+	export()
+	if err := tr.Err(); err == nil {
+		t.Error("failure after a successful export was not reported")
+	}
+}
+
+func TestTracerExpiresUnfinishedLLMSpans(t *testing.T) {
+	tr := &tracer{llm: map[string]*llmSpan{}, kick: make(chan struct{}, 1)}
+	tr.StartLLM("stale", "feed-1", "Trades", 1)
+	tr.StartLLM("fresh", "feed-1", "Trades", 1)
+	tr.llm["stale"].Start = time.Now().Add(-llmSpanTimeout - time.Minute)
+
+	tr.mu.Lock()
+	tr.expireLocked(time.Now())
+	tr.mu.Unlock()
+
+	if _, ok := tr.llm["stale"]; ok {
+		t.Error("stale span still open")
+	}
+	if _, ok := tr.llm["fresh"]; !ok {
+		t.Error("fresh span was expired")
+	}
+	if len(tr.queue) != 1 || tr.queue[0].Status != spanStatusError {
+		t.Fatalf("queue = %+v, want the stale span ended with an error", tr.queue)
+	}
+}
+
+func TestTracingConfigProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		wantErr  bool
+	}{
+		{"", false},
+		{"http/json", false},
+		{"http/protobuf", true}, // spans are only sent as JSON
+		{"grpc", true},
+		{"carrier-pigeon", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			t.Setenv("OTEL_SDK_DISABLED", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+			cfg, err := tracingConfigFromEnv("localhost:4318")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tracingConfigFromEnv error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Endpoint != "http://localhost:4318/v1/traces" {
+				t.Errorf("Endpoint = %q", cfg.Endpoint)
+			}
+		})
+	}
+}
@@ -6,168 +6,520 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/turboline-ai/turbostream-tui/pkg/api"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 )
 
+var (
+	errWSNotConnected = errors.New("websocket not connected")
+	errWSStale        = errors.New("websocket heartbeat timed out")
+	errWSAuth         = errors.New("websocket authentication failed")
+)
+
+// Application close codes the backend uses when it rejects the session.
+const (
+	wsCloseUnauthorized websocket.StatusCode = 4001
+	wsCloseForbidden    websocket.StatusCode = 4003
+)
+
+// wsAuthCloseCodes are the close codes treated as an expired or revoked
+// session; TURBOSTREAM_WS_AUTH_CLOSE_CODES replaces them for backends that
+// use others.
+var wsAuthCloseCodes = []websocket.StatusCode{wsCloseUnauthorized, wsCloseForbidden}
+
 type wsEnvelope struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
+// reconnectPolicy controls how the client redials after the socket drops.
+type reconnectPolicy struct {
+	InitialDelay time.Duration // delay before the first redial
+	MaxDelay     time.Duration // upper bound for the backoff delay
+	Multiplier   float64       // growth factor applied per attempt
+	Jitter       float64       // fraction of the delay that is randomised (0-1)
+	MaxAttempts  int           // 0 retries forever
+}
+
+func defaultReconnectPolicy() reconnectPolicy {
+	return reconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+		Jitter:       0.2,
+		MaxAttempts:  0,
+	}
+}
+
+// Delay returns the backoff delay for the given attempt (1-based).
+func (p reconnectPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		// Spread redials of many clients so a backend restart isn't hammered at once.
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// heartbeatPolicy controls the application-level ping used to detect half-open sockets.
+type heartbeatPolicy struct {
+	Interval time.Duration // how often to ping; 0 disables the heartbeat
+	Timeout  time.Duration // silence after which the connection is considered dead
+}
+
+func defaultHeartbeatPolicy() heartbeatPolicy {
+	return heartbeatPolicy{
+		Interval: 15 * time.Second,
+		Timeout:  45 * time.Second,
+	}
+}
+
 // wsClient wraps the websocket connection and streams messages into the Bubble Tea loop.
+// A supervisor goroutine redials with backoff whenever the connection drops.
 type wsClient struct {
-	conn     *websocket.Conn
-	ctx      context.Context
-	cancel   context.CancelFunc
-	incoming chan tea.Msg
-	userID   string
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	ctx       context.Context
+	cancel    context.CancelFunc
+	incoming  chan tea.Msg
+	url       string
+	userID    string
+	userAgent string
+	token     string // bearer token sent with every handshake (guarded by mu)
+	policy    reconnectPolicy
+	heartbeat heartbeatPolicy
+	ingest    *ingestor          // receives feed-data without blocking the read loop
+	inspector *protocolInspector // counts envelopes and keeps unhandled ones
+
+	lastSeen   atomic.Int64 // unix nanos of the last frame or pong on the current connection
+	closeCause atomic.Pointer[error]
+
+	outbox *wsOutbox     // subscribe/unsubscribe commands awaiting send or ack
+	wake   chan struct{} // kicks the writer when a command is queued
+
+	framing   framingConfig
+	transport *http.Transport
+	wireBytes atomic.Int64 // bytes read off the network across all connections
+
+	cursorMu   sync.Mutex
+	cursors    map[string]feedCursor // feedID -> last feed-data seen, survives redials
+	subscribed map[string]bool       // feeds to restore on every new connection
+
+	recorder  *sessionRecorder // writes every decoded envelope, nil when not recording
+	replaying bool             // envelopes come from a session file, not a socket
 }
 
-func dialWS(url, userID, userAgent string) (*wsClient, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
-		Subprotocols: []string{},
-	})
+// feedCursor is the resume point sent with subscribe-feed after a reconnect.
+type feedCursor struct {
+	Seq  int64     // last sequence number seen (0 if the backend doesn't send one)
+	Time time.Time // timestamp of the last feed-data event
+}
+
+// wsOptions bundles the client's connection policies and the sinks it feeds.
+type wsOptions struct {
+	Token      string
+	Reconnect  reconnectPolicy
+	Heartbeat  heartbeatPolicy
+	AckTimeout time.Duration // how long subscribe/unsubscribe wait for confirmation
+	Framing    framingConfig
+	Transport  *http.Transport // proxy and TLS settings shared with the REST client
+	Ingest     *ingestor
+	Inspector  *protocolInspector
+	Recorder   *sessionRecorder // nil unless the session is being recorded
+}
+
+func dialWS(url, userID, userAgent string, opts wsOptions) (*wsClient, error) {
+	client := newWSClient(url, userID, userAgent, opts)
+	conn, err := client.connect()
 	if err != nil {
-		cancel()
+		client.cancel()
 		return nil, err
 	}
+	client.setConn(conn)
+
+	go client.supervise(conn)
+	return client, nil
+}
+
+// newWSClient builds a client without connecting it.
+func newWSClient(url, userID, userAgent string, opts wsOptions) *wsClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsClient{
+		ctx:        ctx,
+		cancel:     cancel,
+		incoming:   make(chan tea.Msg, 32),
+		url:        url,
+		userID:     userID,
+		userAgent:  userAgent,
+		token:      opts.Token,
+		policy:     opts.Reconnect,
+		heartbeat:  opts.Heartbeat,
+		ingest:     opts.Ingest,
+		inspector:  opts.Inspector,
+		outbox:     newWSOutbox(opts.AckTimeout),
+		wake:       make(chan struct{}, 1),
+		framing:    opts.Framing,
+		transport:  opts.Transport,
+		cursors:    map[string]feedCursor{},
+		subscribed: map[string]bool{},
+		recorder:   opts.Recorder,
+	}
+}
 
-	client := &wsClient{
-		conn:     conn,
-		ctx:      ctx,
-		cancel:   cancel,
-		incoming: make(chan tea.Msg, 32),
-		userID:   userID,
+// connect dials the backend with the session token and registers the user on
+// the new connection.
+func (c *wsClient) connect() (*websocket.Conn, error) {
+	header := http.Header{}
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, resp, err := websocket.Dial(c.ctx, c.url, &websocket.DialOptions{
+		HTTPClient:      c.httpClient(),
+		Subprotocols:    []string{},
+		HTTPHeader:      header,
+		CompressionMode: c.framing.Compression,
+	})
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return nil, fmt.Errorf("%w: HTTP %d", errWSAuth, resp.StatusCode)
+		}
+		return nil, err
 	}
 
 	// Register the user.
 	regPayload := map[string]interface{}{
-		"userId":    userID,
-		"userAgent": userAgent,
+		"userId":    c.userID,
+		"userAgent": c.userAgent,
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 	}
-	if err := wsjson.Write(ctx, conn, map[string]interface{}{
+	if c.framing.MessagePack {
+		// Binary frames are decoded whatever we ask for; this only states a preference
+		regPayload["encoding"] = "msgpack"
+	}
+	if err := wsjson.Write(c.ctx, conn, map[string]interface{}{
 		"type":    "register-user",
 		"payload": regPayload,
 	}); err != nil {
 		if closeErr := conn.Close(websocket.StatusInternalError, "register failed"); closeErr != nil {
 			log.Printf("error closing connection after registration failure: %v", closeErr)
 		}
-		cancel()
 		return nil, fmt.Errorf("register-user failed: %w", err)
 	}
-
-	go client.readLoop()
-	return client, nil
+	return conn, nil
 }
 
-func (c *wsClient) readLoop() {
+// supervise runs the read loop and redials with backoff until the client is
+// closed or the reconnect policy gives up.
+func (c *wsClient) supervise(conn *websocket.Conn) {
 	defer func() {
 		close(c.incoming)
 	}()
 
 	for {
-		var env wsEnvelope
-		if err := wsjson.Read(c.ctx, c.conn, &env); err != nil {
-			c.incoming <- wsStatusMsg{Status: "disconnected", Err: err}
+		c.markAlive()
+		hbCtx, stopHeartbeat := context.WithCancel(c.ctx)
+		go c.runHeartbeat(hbCtx, conn)
+		go c.runAckTimer(hbCtx)
+		go c.runWriter(hbCtx)
+
+		err := c.readLoop(conn)
+		stopHeartbeat()
+		c.setConn(nil)
+		c.outbox.requeue()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if cause := c.closeCause.Swap(nil); cause != nil {
+			err = *cause
+		}
+		if isAuthFailure(err) {
+			// Redialing with the same token would be rejected again
+			c.emit(wsAuthFailedMsg{Err: err})
 			return
 		}
 
-		switch env.Type {
-		case "registration-success":
-			c.incoming <- wsStatusMsg{Status: "connected", Err: nil}
-		case "feed-data":
-			var payload struct {
-				FeedID    string          `json:"feedId"`
-				FeedName  string          `json:"feedName"`
-				EventName string          `json:"eventName"`
-				Data      json.RawMessage `json:"data"`
-				Timestamp string          `json:"timestamp"`
-			}
-			if err := json.Unmarshal(env.Payload, &payload); err == nil {
-				ts, _ := time.Parse(time.RFC3339, payload.Timestamp)
-				c.incoming <- feedDataMsg{
-					FeedID:    payload.FeedID,
-					FeedName:  payload.FeedName,
-					EventName: payload.EventName,
-					Data:      string(payload.Data),
-					Time:      ts,
-				}
-			} else {
-				// Report packet dropped due to parse error
-				c.incoming <- packetDroppedMsg{
-					FeedID: payload.FeedID,
-					Reason: "json_parse_error",
-				}
-			}
-		case "token-usage-update":
-			var usage api.TokenUsage
-			if err := json.Unmarshal(env.Payload, &usage); err == nil {
-				c.incoming <- tokenUsageUpdateMsg{Usage: &usage}
-			}
-		case "subscription-success", "unsubscription-success":
-			// No-op; REST already returns status.
-		case "llm-response":
-			var payload struct {
-				RequestID  string `json:"requestId"`
-				Answer     string `json:"answer"`
-				Provider   string `json:"provider"`
-				DurationMs int64  `json:"durationMs"`
-			}
-			if err := json.Unmarshal(env.Payload, &payload); err == nil {
-				c.incoming <- aiResponseMsg{
-					RequestID: payload.RequestID,
-					Answer:    payload.Answer,
-					Provider:  payload.Provider,
-					Duration:  payload.DurationMs,
-				}
-			}
-		case "llm-token":
-			var payload struct {
-				RequestID string `json:"requestId"`
-				Token     string `json:"token"`
-			}
-			if err := json.Unmarshal(env.Payload, &payload); err == nil {
-				c.incoming <- aiTokenMsg{
-					RequestID: payload.RequestID,
-					Token:     payload.Token,
-				}
-			}
-		case "llm-complete":
-			var payload struct {
-				RequestID  string `json:"requestId"`
-				Answer     string `json:"answer"`
-				Provider   string `json:"provider"`
-				DurationMs int64  `json:"durationMs"`
-			}
-			if err := json.Unmarshal(env.Payload, &payload); err == nil {
-				c.incoming <- aiResponseMsg{
-					RequestID: payload.RequestID,
-					Answer:    payload.Answer,
-					Provider:  payload.Provider,
-					Duration:  payload.DurationMs,
-				}
-			}
-		case "llm-error":
-			var payload struct {
-				RequestID string `json:"requestId"`
-				Error     string `json:"error"`
-			}
-			if err := json.Unmarshal(env.Payload, &payload); err == nil {
-				c.incoming <- aiResponseMsg{
-					RequestID: payload.RequestID,
-					Err:       errors.New(payload.Error),
-				}
+		conn = c.redial(err)
+		if conn == nil {
+			return
+		}
+		// The new connection has no subscriptions; restore them with resume cursors
+		c.resubscribe()
+		c.emit(wsReconnectedMsg{})
+	}
+}
+
+// redial retries the connection following the reconnect policy. It returns nil
+// when the client was closed or the maximum number of attempts was reached.
+func (c *wsClient) redial(cause error) *websocket.Conn {
+	lastErr := cause
+	for attempt := 1; ; attempt++ {
+		if c.policy.MaxAttempts > 0 && attempt > c.policy.MaxAttempts {
+			c.emit(wsStatusMsg{
+				Status: "disconnected",
+				Err:    fmt.Errorf("giving up after %d reconnect attempts: %w", c.policy.MaxAttempts, lastErr),
+			})
+			return nil
+		}
+
+		delay := c.policy.Delay(attempt)
+		c.emit(wsStatusMsg{
+			Status:      "reconnecting",
+			Err:         lastErr,
+			Attempt:     attempt,
+			MaxAttempts: c.policy.MaxAttempts,
+			RetryAt:     time.Now().Add(delay),
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		conn, err := c.connect()
+		if err == nil {
+			c.setConn(conn)
+			return conn
+		}
+		if c.ctx.Err() != nil {
+			return nil
+		}
+		if isAuthFailure(err) {
+			c.emit(wsAuthFailedMsg{Err: err})
+			return nil
+		}
+		lastErr = err
+	}
+}
+
+// isAuthFailure reports whether the backend rejected the session token, either
+// at the handshake, with an auth-error envelope, or with an auth close code.
+func isAuthFailure(err error) bool {
+	if errors.Is(err, errWSAuth) {
+		return true
+	}
+	status := websocket.CloseStatus(err)
+	if status < 0 {
+		return false
+	}
+	for _, code := range wsAuthCloseCodes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// runHeartbeat pings the peer on the policy interval and reports round-trip
+// latency. If nothing is heard for longer than the timeout, the connection is
+// closed so the supervisor redials.
+func (c *wsClient) runHeartbeat(ctx context.Context, conn *websocket.Conn) {
+	if c.heartbeat.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.heartbeat.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.heartbeat.Timeout > 0 && time.Since(c.lastSeenTime()) > c.heartbeat.Timeout {
+			c.abort(conn, errWSStale, "heartbeat timeout")
+			return
+		}
+
+		pingTimeout := c.heartbeat.Timeout
+		if pingTimeout <= 0 {
+			pingTimeout = c.heartbeat.Interval
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		start := time.Now()
+		err := conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				// Ping closes the connection itself when the pong never arrives.
+				c.abort(conn, fmt.Errorf("%w: %v", errWSStale, err), "heartbeat timeout")
 			}
-		default:
-			// unknown types are ignored but logged in status.
+			return
 		}
+		c.markAlive()
+		rtt := time.Since(start)
+		c.recorder.Pong(rtt)
+		c.emit(wsHeartbeatMsg{RTT: rtt, At: time.Now()})
+	}
+}
+
+// abort closes a connection the client gives up on and records why, so the
+// supervisor can report the real cause instead of the resulting read error.
+func (c *wsClient) abort(conn *websocket.Conn, cause error, reason string) {
+	c.closeCause.Store(&cause)
+	_ = conn.Close(websocket.StatusGoingAway, reason)
+}
+
+// abortAsync is abort for the read goroutine: the close handshake waits for
+// the peer's close frame, which only that goroutine can read.
+func (c *wsClient) abortAsync(conn *websocket.Conn, cause error, reason string) {
+	c.closeCause.Store(&cause)
+	go func() { _ = conn.Close(websocket.StatusGoingAway, reason) }()
+}
+
+func (c *wsClient) markAlive() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+func (c *wsClient) lastSeenTime() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// advanceCursor records a feed-data event and reports a gap when sequence
+// numbers jump. It returns false for duplicates replayed after a reconnect.
+// Feeds that only carry timestamps still resume from the last one, but a
+// hole in them can't be told apart from a quiet stream; only the backend's
+// feed-gap reports it.
+func (c *wsClient) advanceCursor(feedID string, seq int64, ts time.Time) bool {
+	c.cursorMu.Lock()
+	prev, seen := c.cursors[feedID]
+	if seq > 0 && seen && prev.Seq > 0 && seq <= prev.Seq {
+		c.cursorMu.Unlock()
+		return false
+	}
+	next := feedCursor{Seq: seq, Time: ts}
+	if next.Time.IsZero() {
+		next.Time = prev.Time
+	}
+	c.cursors[feedID] = next
+	c.cursorMu.Unlock()
+
+	if seq > 0 && seen && prev.Seq > 0 && seq > prev.Seq+1 {
+		c.emit(feedGapMsg{
+			FeedID: feedID,
+			Missed: seq - prev.Seq - 1,
+			From:   prev.Time,
+			To:     ts,
+		})
+	}
+	return true
+}
+
+// skipCursor moves the resume point past a range the backend declared lost.
+func (c *wsClient) skipCursor(feedID string, seq int64, ts time.Time) {
+	c.cursorMu.Lock()
+	defer c.cursorMu.Unlock()
+	cursor := c.cursors[feedID]
+	if seq > cursor.Seq {
+		cursor.Seq = seq
+	}
+	if ts.After(cursor.Time) {
+		cursor.Time = ts
+	}
+	c.cursors[feedID] = cursor
+}
+
+func (c *wsClient) cursor(feedID string) (feedCursor, bool) {
+	c.cursorMu.Lock()
+	defer c.cursorMu.Unlock()
+	cursor, ok := c.cursors[feedID]
+	return cursor, ok
+}
+
+// emit delivers a message to the UI unless the client is shutting down.
+func (c *wsClient) emit(msg tea.Msg) {
+	select {
+	case c.incoming <- msg:
+	case <-c.ctx.Done():
+	}
+}
+
+// SetToken replaces the token used for future handshakes after a refresh.
+func (c *wsClient) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+func (c *wsClient) setConn(conn *websocket.Conn) {
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+}
+
+func (c *wsClient) currentConn() *websocket.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+func (c *wsClient) readLoop(conn *websocket.Conn) error {
+	for {
+		before := c.wireBytes.Load()
+		typ, data, err := conn.Read(c.ctx)
+		if err != nil {
+			return err
+		}
+		c.markAlive()
+		frame := frameSize{Wire: int(c.wireBytes.Load() - before), Decoded: len(data)}
+		c.ingest.metrics.RecordConnectionBytes(backendConnection, frame.Wire, frame.Decoded)
+
+		raw, err := decodeFrame(typ, data)
+		if err != nil {
+			c.inspector.RecordIssue("(binary)", err.Error(), data, false)
+			continue
+		}
+		c.recorder.Envelope(raw, frame)
+		c.dispatch(raw)
+	}
+}
+
+// dispatch routes one envelope through the handler registry. Unknown types and
+// payloads that fail to decode are recorded for the protocol inspector.
+func (c *wsClient) dispatch(raw json.RawMessage) {
+	var env wsEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		c.inspector.RecordIssue("(malformed)", err.Error(), raw, false)
+		return
+	}
+
+	handler, ok := envelopeHandlers[env.Type]
+	if !ok {
+		c.inspector.RecordIssue(env.Type, "unknown envelope type", raw, true)
+		return
+	}
+
+	msg, err := handler(c, env.Payload)
+	if err != nil {
+		c.inspector.RecordIssue(env.Type, err.Error(), raw, false)
+	} else {
+		c.inspector.RecordHandled(env.Type)
+	}
+	if msg != nil {
+		c.emit(msg)
 	}
 }
 
@@ -175,43 +527,103 @@ func (c *wsClient) ListenCmd() tea.Cmd {
 	return func() tea.Msg {
 		msg, ok := <-c.incoming
 		if !ok {
-			return wsStatusMsg{Status: "disconnected", Err: errors.New("ws closed")}
+			// The supervisor already reported the final status before closing.
+			return nil
 		}
 		return msg
 	}
 }
 
-func (c *wsClient) Subscribe(feedID string) error {
-	return c.send(map[string]interface{}{
-		"type": "subscribe-feed",
-		"payload": map[string]string{
-			"feedId": feedID,
-			"userId": c.userID,
-		},
+// Subscribe queues a subscription for the writer, which sends it once the
+// socket is up. The result arrives later as a wsCommandResultMsg once the
+// backend confirms or rejects it, or the ack times out.
+func (c *wsClient) Subscribe(feedID string) {
+	c.cursorMu.Lock()
+	c.subscribed[feedID] = true
+	c.cursorMu.Unlock()
+	c.queueSubscribe(feedID)
+	c.kick()
+}
+
+// queueSubscribe adds a subscribe-feed command. The envelope is built at send
+// time so a resend after a reconnect carries the latest resume point.
+func (c *wsClient) queueSubscribe(feedID string) {
+	c.outbox.add("subscribe", feedID, func(requestID string) map[string]interface{} {
+		payload := map[string]interface{}{
+			"feedId":    feedID,
+			"userId":    c.userID,
+			"requestId": requestID,
+		}
+		if cursor, ok := c.cursor(feedID); ok {
+			if cursor.Seq > 0 {
+				payload["lastSeq"] = cursor.Seq
+			}
+			if !cursor.Time.IsZero() {
+				payload["lastTimestamp"] = cursor.Time.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		return map[string]interface{}{
+			"type":    "subscribe-feed",
+			"payload": payload,
+		}
 	})
 }
 
-func (c *wsClient) Unsubscribe(feedID string) error {
-	return c.send(map[string]interface{}{
-		"type": "unsubscribe-feed",
-		"payload": map[string]string{
-			"feedId": feedID,
-			"userId": c.userID,
-		},
+// resubscribe queues subscribe-feed for every feed that has no command in flight.
+func (c *wsClient) resubscribe() {
+	c.cursorMu.Lock()
+	feedIDs := make([]string, 0, len(c.subscribed))
+	for feedID := range c.subscribed {
+		feedIDs = append(feedIDs, feedID)
+	}
+	c.cursorMu.Unlock()
+
+	for _, feedID := range feedIDs {
+		if !c.outbox.hasPending(feedID) {
+			c.queueSubscribe(feedID)
+		}
+	}
+}
+
+// Unsubscribe queues an unsubscription and forgets the feed's resume point.
+func (c *wsClient) Unsubscribe(feedID string) {
+	c.cursorMu.Lock()
+	delete(c.cursors, feedID)
+	delete(c.subscribed, feedID)
+	c.cursorMu.Unlock()
+	c.outbox.add("unsubscribe", feedID, func(requestID string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "unsubscribe-feed",
+			"payload": map[string]string{
+				"feedId":    feedID,
+				"userId":    c.userID,
+				"requestId": requestID,
+			},
+		}
 	})
+	c.kick()
 }
 
-// SendLLMQuery sends a query to the LLM service via WebSocket
-func (c *wsClient) SendLLMQuery(feedID, question, systemPrompt, requestID string) error {
-	return c.send(map[string]interface{}{
-		"type": "llm-query-stream",
-		"payload": map[string]string{
-			"feedId":       feedID,
-			"question":     question,
-			"systemPrompt": systemPrompt,
-			"requestId":    requestID,
-		},
+// SendLLMQuery sends a query to the LLM service via WebSocket. A non-empty
+// traceparent lets the backend join the TUI's trace of the request.
+func (c *wsClient) SendLLMQuery(feedID, question, systemPrompt, requestID, traceparent string) error {
+	payload := map[string]string{
+		"feedId":       feedID,
+		"question":     question,
+		"systemPrompt": systemPrompt,
+		"requestId":    requestID,
+	}
+	if traceparent != "" {
+		payload["traceparent"] = traceparent
+	}
+	err := c.send(map[string]interface{}{
+		"type":    "llm-query-stream",
+		"payload": payload,
 	})
+	if err == nil {
+		c.recorder.Query(requestID, feedID, question)
+	}
+	return err
 }
 
 // SendLLMStreamQuery sends a streaming query to the LLM service
@@ -226,13 +638,30 @@ func (c *wsClient) SendLLMStreamQuery(feedID, question, requestID string) error
 	})
 }
 
+// CancelLLMQuery asks the backend to stop generating an in-flight response
+func (c *wsClient) CancelLLMQuery(requestID string) error {
+	c.recorder.Cancel(requestID)
+	return c.send(map[string]interface{}{
+		"type": "llm-cancel",
+		"payload": map[string]string{
+			"requestId": requestID,
+		},
+	})
+}
+
 func (c *wsClient) send(msg interface{}) error {
+	conn := c.currentConn()
+	if conn == nil {
+		return errWSNotConnected
+	}
 	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
 	defer cancel()
-	return wsjson.Write(ctx, c.conn, msg)
+	return wsjson.Write(ctx, conn, msg)
 }
 
 func (c *wsClient) Close() {
 	c.cancel()
-	_ = c.conn.Close(websocket.StatusNormalClosure, "bye")
+	if conn := c.currentConn(); conn != nil {
+		_ = conn.Close(websocket.StatusNormalClosure, "bye")
+	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	p := reconnectPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second}, // clamped to the first attempt
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second}, // capped
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectDelayJitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  reconnectPolicy
+		attempt int
+		base    time.Duration // delay before jitter
+	}{
+		{"first attempt", reconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0.2}, 1, time.Second},
+		{"grown", reconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0.2}, 4, 8 * time.Second},
+		{"at the cap", reconnectPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2, Jitter: 0.5}, 10, 5 * time.Second},
+		{"full jitter", reconnectPolicy{InitialDelay: time.Second, Multiplier: 1, Jitter: 1}, 1, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo := time.Duration(float64(tt.base) * (1 - tt.policy.Jitter))
+			hi := time.Duration(float64(tt.base) * (1 + tt.policy.Jitter))
+			var below, above bool
+			for i := 0; i < 1000; i++ {
+				d := tt.policy.Delay(tt.attempt)
+				if d < lo || d > hi {
+					t.Fatalf("Delay(%d) = %v, outside [%v, %v]", tt.attempt, d, lo, hi)
+				}
+				below = below || d < tt.base
+				above = above || d > tt.base
+			}
+			if !below || !above {
+				t.Errorf("1000 delays never spread both ways around %v", tt.base)
+			}
+		})
+	}
+}
+
+func TestAdvanceCursor(t *testing.T) {
+	at := func(sec int) time.Time { return time.Unix(1_700_000_000+int64(sec), 0) }
+	type event struct {
+		seq int64
+		ts  time.Time
+	}
+	tests := []struct {
+		name   string
+		events []event
+		accept []bool
+		gaps   []feedGapMsg
+		cursor feedCursor // after the last event
+	}{
+		{"in order", []event{{1, at(1)}, {2, at(2)}, {3, at(3)}}, []bool{true, true, true}, nil, feedCursor{3, at(3)}},
+		{"sequence gap", []event{{1, at(1)}, {5, at(9)}}, []bool{true, true},
+			[]feedGapMsg{{FeedID: "f", Missed: 3, From: at(1), To: at(9)}}, feedCursor{5, at(9)}},
+		{"duplicates after a redial", []event{{4, at(4)}, {3, at(3)}, {4, at(4)}, {5, at(5)}}, []bool{true, false, false, true}, nil, feedCursor{5, at(5)}},
+		{"gap without a timestamp after it", []event{{1, at(1)}, {3, time.Time{}}}, []bool{true, true},
+			[]feedGapMsg{{FeedID: "f", Missed: 1, From: at(1)}}, feedCursor{3, at(1)}},
+		{"gap without a timestamp before it", []event{{1, time.Time{}}, {4, at(4)}}, []bool{true, true},
+			[]feedGapMsg{{FeedID: "f", Missed: 2, To: at(4)}}, feedCursor{4, at(4)}},
+		// Without sequence numbers a hole can't be told from a quiet stream
+		{"timestamps only", []event{{0, at(1)}, {0, at(60)}, {0, at(2)}}, []bool{true, true, true}, nil, feedCursor{0, at(2)}},
+		{"timestamp kept when an event has none", []event{{0, at(5)}, {0, time.Time{}}}, []bool{true, true}, nil, feedCursor{0, at(5)}},
+		{"sequence starts late", []event{{0, at(1)}, {7, at(2)}}, []bool{true, true}, nil, feedCursor{7, at(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &wsClient{ctx: context.Background(), incoming: make(chan tea.Msg, 16), cursors: map[string]feedCursor{}}
+			for i, e := range tt.events {
+				if got := c.advanceCursor("f", e.seq, e.ts); got != tt.accept[i] {
+					t.Errorf("event %d (seq %d): accepted = %v, want %v", i, e.seq, got, tt.accept[i])
+				}
+			}
+			close(c.incoming)
+			var gaps []feedGapMsg
+			for msg := range c.incoming {
+				gaps = append(gaps, msg.(feedGapMsg))
+			}
+			if !reflect.DeepEqual(gaps, tt.gaps) {
+				t.Errorf("gaps = %+v, want %+v", gaps, tt.gaps)
+			}
+			if got, _ := c.cursor("f"); got != tt.cursor {
+				t.Errorf("cursor = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}